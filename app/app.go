@@ -25,17 +25,52 @@ import (
 	"bookmarks"
 	"fmt"
 	"http"
+	"io/ioutil"
 	"mustache"
+	"os"
+	"rand"
+	"strconv"
 	"strings"
+	"time"
+	"url"
 )
 
+// schemesFile lists the URL schemes bookmarks may use, see
+// bookmarks.ParseSchemes.
+const schemesFile = "schemes.txt"
+
 func init() {
-	http.HandleFunc("/", handleIndex)
-	http.HandleFunc("/welcome", handleWelcome)
-	http.HandleFunc("/create", handleCreate)
-	http.HandleFunc("/delete", handleDelete)
-	http.HandleFunc("/export", handleExport)
-	http.HandleFunc("/bookmarklet", handleBookmarklet)
+	rand.Seed(time.Nanoseconds())
+	if err := loadSchemes(schemesFile); err != nil {
+		panic(schemesFile + ": " + err.String())
+	}
+
+	http.HandleFunc("/", secure(handleIndex))
+	http.HandleFunc("/welcome", secure(handleWelcome))
+	http.HandleFunc("/create", secure(handleCreate))
+	http.HandleFunc("/edit/", secure(handleEdit))
+	http.HandleFunc("/delete", secure(handleDelete))
+	http.HandleFunc("/export", secure(handleExport))
+	http.HandleFunc("/bookmarklet", secure(handleBookmarklet))
+	http.HandleFunc("/go/", secure(handleGo))
+}
+
+// loadSchemes replaces the allowed URL schemes with the ones configured in
+// the file. Without the file, the defaults stay.
+func loadSchemes(filename string) os.Error {
+	text, err := ioutil.ReadFile(filename)
+	if e, ok := err.(*os.PathError); ok && e.Error == os.ENOENT {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	schemes, err := bookmarks.ParseSchemes(string(text))
+	if err != nil {
+		return err
+	}
+	bookmarks.AllowedSchemes = schemes
+	return nil
 }
 
 func pluralize(text string, count int, prepend bool) string {
@@ -53,6 +88,30 @@ func handleWelcome(w http.ResponseWriter, r *http.Request) {
 	output(c, w, "welcome");
 }
 
+// userBookmarks loads all bookmarks of the user at most once per request,
+// for the steps of the listing that need them.
+type userBookmarks struct {
+	c      appengine.Context
+	bms    []bookmarks.Bookmark
+	loaded bool
+}
+
+func newUserBookmarks(c appengine.Context) *userBookmarks {
+	return &userBookmarks{c: c}
+}
+
+// all returns all bookmarks of the user, hidden ones included.
+func (l *userBookmarks) all() ([]bookmarks.Bookmark, os.Error) {
+	if !l.loaded {
+		bms, err := bookmarks.ByTags(l.c, []string{})
+		if err != nil {
+			return nil, err
+		}
+		l.bms, l.loaded = bms, true
+	}
+	return l.bms, nil
+}
+
 func handleIndex(w http.ResponseWriter, r *http.Request) {
 	c := appengine.NewContext(r)
 	u := user.Current(c)
@@ -61,8 +120,36 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	settings, err := bookmarks.CurrentSettings(c)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
 	// Extract query information in form of ?q=multiple,tags+search+string
+	// The start page shows the dashboard or lists the configured start
+	// query instead
 	fullQuery := r.FormValue("q")
+	if fullQuery == "" && settings.Dashboard != "" {
+		outputDashboard(c, w, settings)
+		return
+	}
+	startPage := fullQuery == "" && settings.StartQuery != ""
+	if startPage {
+		fullQuery = settings.StartQuery
+	}
+
+	// Saved searches ("@name") are replaced by their query
+	shownQuery := fullQuery
+	fullQuery, savedSort, err := expandCollections(c, fullQuery)
+	if err == bookmarks.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
 	queryParts := strings.SplitN(fullQuery, " ", 2)
 	tagString := queryParts[0]
 	query := ""
@@ -70,6 +157,12 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 		query = queryParts[1]
 	}
 
+	// A trailing "?" picks one of the matches at random
+	pickRandom := strings.HasSuffix(tagString, "?")
+	if pickRandom {
+		tagString = tagString[:len(tagString)-1]
+	}
+
 	// Get tag array (from tagString or default)
 	var tags []string
 	if tagString == "" && query == "" {
@@ -79,50 +172,124 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Follow mode or just listing?
-	followMode := true
+	followMode := !startPage
 	if has, i := bookmarks.ContainsTag(tags, "-follow"); has {
 		followMode = false
 		tags = append(tags[:i], tags[i+1:]...)
 	}
 
-	// If tag "hidden" is not passed, hide all "hidden" tags
-	if has, _ := bookmarks.ContainsTag(tags, "hidden"); !has {
-		tags = append(tags, "-hidden")
+	// Open all matches at once?
+	openAll := false
+	if has, i := bookmarks.ContainsTag(tags, "-all"); has {
+		openAll = true
+		tags = append(tags[:i], tags[i+1:]...)
+	}
+
+	// Forgiving tag matching or exact tags only?
+	fuzzy := true
+	if has, i := bookmarks.ContainsTag(tags, "-exact"); has {
+		fuzzy = false
+		tags = append(tags[:i], tags[i+1:]...)
 	}
 
-	// Fetch bookmarks with tags
-	marks, err := bookmarks.ByTags(c, tags)
+	// Fetch bookmarks with tags. Suggestions, fallbacks and the saved
+	// searches need all bookmarks, which are only loaded once.
+	loaded := newUserBookmarks(c)
+	marks, err := bookmarks.ByTags(c, settings.HideTags(tags))
 	if err != nil {
 		http.Error(w, err.String(), http.StatusInternalServerError)
 		return
 	}
 
-	// If no bookmarks with these tags are found, use "default" tag with query
-	// as fallback, e.g. for search engine link
-	if len(marks) == 0 {
-		query = fullQuery
-		tagString = "default"
-		marks, err = bookmarks.ByTags(c, []string{"default"})
+	// Nothing found? Complete unique tag prefixes, or suggest similar tags
+	// in case of a typo
+	var suggestions []map[string]string
+	if len(marks) == 0 && fuzzy && tagString != "" {
+		all, err := loaded.all()
+		if err != nil {
+			http.Error(w, err.String(), http.StatusInternalServerError)
+			return
+		}
+		counts := bookmarks.CountTags(bookmarks.Match(all, settings.HideTags([]string{})))
+		if resolved, ok := resolveTags(counts, tags); ok && strings.Join(resolved, ",") != strings.Join(tags, ",") {
+			marks = bookmarks.Match(all, settings.HideTags(resolved))
+			tags, tagString = resolved, strings.Join(resolved, ",")
+		}
+		if len(marks) == 0 {
+			suggestions = similarQueries(counts, tags, query)
+		}
 	}
-	if err != nil {
-		http.Error(w, err.String(), http.StatusInternalServerError)
-		return
+
+	// If no bookmarks with these tags are found, try the user's fallback
+	// chain, e.g. the "default" tag with the query for a search engine link.
+	// Bulk operations only apply to the bookmarks matching the query itself.
+	redirectSingle := settings.FollowRedirect
+	fallback := false
+	if len(marks) == 0 {
+		steps, _ := bookmarks.ParseFallbacks(settings.Fallbacks)
+		res, err := runFallbacks(c, settings, loaded, steps, tags, query, fullQuery)
+		if err != nil {
+			http.Error(w, err.String(), http.StatusInternalServerError)
+			return
+		}
+		if len(res.marks) > 0 {
+			marks, tagString, query = res.marks, res.tagString, res.query
+			fallback = true
+		}
+		// Don't skip the suggestions by redirecting to a fallback
+		redirectSingle = redirectSingle && res.redirect && len(suggestions) == 0
 	}
 
-	// Search query passed? Format URLs
+	// Search query passed? Remember it for formatting the URLs. Searches
+	// of fallback engines are expanded already.
 	if query != "" {
 		for i := 0; i < len(marks); i++ {
-			marks[i].URL = strings.Replace(marks[i].URL, "%s", query, -1)
+			if marks[i].Stored() {
+				marks[i].Query = query
+			}
+		}
+	}
+
+	// Operators acting on all matches
+	if pickRandom {
+		if bm, ok := randomMatch(marks); ok {
+			follow(c, w, r, bm)
+			return
 		}
 	}
+	if openAll && len(marks) > 0 {
+		bookmarks.SortBy(marks, settings.DefaultSort)
+		output(c, w, "launcher", map[string]interface{}{
+			"title": "Open " + pluralize("bookmark", len(marks), true),
+			"query": fullQuery,
+			"bookmarks": marks,
+		})
+		return
+	}
 
 	// Navigate directly if a single bookmark was found
-	if followMode && len(marks) == 1 {
-		w.Header().Set("Location", marks[0].URL)
-		w.WriteHeader(http.StatusFound)
+	if followMode && redirectSingle && len(marks) == 1 && bookmarks.ValidURL(marks[0].URL) {
+		follow(c, w, r, marks[0])
 		return
 	}
 
+	// With "top" set, navigate to the bookmark used clearly most often
+	if followMode && r.FormValue("top") != "" {
+		if i := bookmarks.TopMatch(marks); i >= 0 && bookmarks.ValidURL(marks[i].URL) {
+			follow(c, w, r, marks[i])
+			return
+		}
+	}
+
+	sortOrder := r.FormValue("sort")
+	if sortOrder == "" {
+		sortOrder = savedSort
+	}
+	if sortOrder == "" {
+		sortOrder = settings.DefaultSort
+	}
+	bookmarks.SortBy(marks, sortOrder)
+
 	// Create title
 	title := pluralize("Bookmark", len(marks), true)
 	if tagString != "" {
@@ -137,15 +304,117 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 		title += " query '" + query + "'"
 	}
 
+	collections, err := countCollections(c, settings, loaded)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
 	output(c, w, "index", map[string]interface{}{
 		"count": len(marks),
 		"title": title,
-		"query": fullQuery,
+		"query": shownQuery,
+		"queryArg": url.QueryEscape(shownQuery),
+		"sort": sortOrder,
 		"tagString": tagString,
+		"tagStringArg": bookmarkletArg(tagString),
 		"bookmarks": marks,
+		"bulk": !fallback && len(marks) > 0 && len(bookmarks.ParseTags(tagString)) > 0,
+		"suggestions": suggestions,
+		"hasSuggestions": len(suggestions) > 0,
+		"collections": collections,
 	});
 }
 
+// handleGo redirects to the bookmark given by /go/{id} and records the
+// visit.
+func handleGo(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		redirectToLogin(c, w, r)
+		return
+	}
+
+	id, err := strconv.Atoi64(r.URL.Path[len("/go/"):])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	bm, err := bookmarks.ByID(c, id)
+	if err == bookmarks.ErrNotFound || err == nil && !bookmarks.ValidURL(bm.URL) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	bm.Query = r.FormValue("q")
+	follow(c, w, r, bm)
+}
+
+// randomMatch picks one of the bookmarks that can be followed.
+func randomMatch(bms []bookmarks.Bookmark) (bookmarks.Bookmark, bool) {
+	var valid []bookmarks.Bookmark
+	for _, b := range bms {
+		if bookmarks.ValidURL(b.URL) {
+			valid = append(valid, b)
+		}
+	}
+	if len(valid) == 0 {
+		return bookmarks.Bookmark{}, false
+	}
+	return valid[rand.Intn(len(valid))], true
+}
+
+// follow records a visit of the bookmark and redirects to its URL, formatted
+// with the search query. With "noreferrer" set or the NoReferrer setting on,
+// the redirect itself forbids sending a referrer as well.
+func follow(c appengine.Context, w http.ResponseWriter, r *http.Request, bm bookmarks.Bookmark) {
+	target := bm.TargetURL()
+	if !bookmarks.ValidURL(target) {
+		http.Error(w, bookmarks.ErrInvalidScheme.String(), http.StatusBadRequest)
+		return
+	}
+
+	if bm.Id != 0 {
+		if err := bookmarks.Visit(c, bm.Id); err != nil {
+			c.Errorf("follow: recording visit of %d: %v", bm.Id, err)
+		}
+	}
+
+	noReferrer := r.FormValue("noreferrer") != ""
+	if !noReferrer {
+		if settings, err := bookmarks.CurrentSettings(c); err != nil {
+			c.Errorf("follow: loading settings: %v", err)
+		} else {
+			noReferrer = settings.NoReferrer
+		}
+	}
+	if noReferrer {
+		w.Header().Set("Referrer-Policy", "no-referrer")
+	}
+
+	// Search engines that only accept POST get an auto-submitting form
+	if bm.Method == bookmarks.MethodPost {
+		formTarget := ""
+		if u, err := url.Parse(target); err == nil {
+			formTarget = u.Scheme + "://" + u.Host
+		}
+		outputPage(c, w, []string{formTarget}, "follow_post", map[string]interface{}{
+			"title": bm.Title,
+			"action": target,
+			"fields": bm.FormFields(),
+		})
+		return
+	}
+
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusFound)
+}
+
 func handleCreate(w http.ResponseWriter, r *http.Request) {
 	c := appengine.NewContext(r)
 	u := user.Current(c)
@@ -157,16 +426,38 @@ func handleCreate(w http.ResponseWriter, r *http.Request) {
 	url := r.FormValue("url")
 	title := r.FormValue("title")
 	tagString := r.FormValue("tags")
-	if url == "" {
-		output(c, w, "create");
+
+	// Anything but a POST just shows the (prefilled) form
+	if url == "" || r.Method != "POST" {
+		output(c, w, "create", map[string]interface{}{
+			"url": url,
+			"title": title,
+			"tags": tagString,
+			"body": r.FormValue("body"),
+			"post": r.FormValue("method") == bookmarks.MethodPost,
+		});
+		return
+	}
+	if !requirePost(c, w, r, u) {
 		return
 	}
 
 	tags := strings.Split(tagString, ",")
 	bm := bookmarks.NewBookmark(u, url, title, tags)
+	bm.Method = r.FormValue("method")
+	bm.Body = r.FormValue("body")
 	_, err := bm.Save(c)
 	if err != nil {
-		http.Error(w, err.String(), http.StatusInternalServerError)
+		saveError(w, err)
+		return
+	}
+
+	// The bookmarklet popup closes itself after saving
+	if r.FormValue("popup") != "" {
+		output(c, w, "bookmarklet_popup", map[string]interface{}{
+			"title": bm.Title,
+			"saved": true,
+		})
 		return
 	}
 
@@ -175,12 +466,74 @@ func handleCreate(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// handleEdit shows the form for /edit/{id} and updates the bookmark when it
+// is submitted, which may also change its URL.
+func handleEdit(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		redirectToLogin(c, w, r)
+		return
+	}
+
+	id, err := strconv.Atoi64(r.URL.Path[len("/edit/"):])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	bm, err := bookmarks.ByID(c, id)
+	if err == bookmarks.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	notice := ""
+	if r.Method == "POST" {
+		if !requirePost(c, w, r, u) {
+			return
+		}
+
+		bm = bookmarks.NewBookmark(u, r.FormValue("url"), r.FormValue("title"), strings.Split(r.FormValue("tags"), ","))
+		bm.Id = id
+		bm.Method = r.FormValue("method")
+		bm.Body = r.FormValue("body")
+		switch err = bm.Update(c); err {
+		case nil:
+			http.Redirect(w, r, rootURL(c), http.StatusFound)
+			return
+		case bookmarks.ErrURLExists, bookmarks.ErrInvalidScheme, bookmarks.ErrInvalidMethod:
+			notice = err.String()
+		default:
+			http.Error(w, err.String(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	view := map[string]interface{}{
+		"title": "Edit '" + bm.Title + "'",
+		"bookmark": bm,
+		"post": bm.Method == bookmarks.MethodPost,
+	}
+	// Empty strings still render mustache sections
+	if notice != "" {
+		view["notice"] = notice
+	}
+	output(c, w, "edit", view)
+}
+
 func handleDelete(w http.ResponseWriter, r *http.Request) {
 	c := appengine.NewContext(r)
 	u := user.Current(c)
 	if u == nil {
 		return
 	}
+	if !requirePost(c, w, r, u) {
+		return
+	}
 
 	url := r.FormValue("url")
 	bm := bookmarks.NewBookmark(u, url, "", []string{});
@@ -202,12 +555,54 @@ func handleExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	marks, err := bookmarks.ByTags(c, []string{})
+	settings, err := bookmarks.CurrentSettings(c)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	// Export everything or just the bookmarks of a query like "@name".
+	// Queries and the EPUB hide bookmarks like the listing does.
+	tags := []string{}
+	q := r.FormValue("q")
+	format := r.FormValue("format")
+	if q != "" {
+		expanded, _, err := expandCollections(c, q)
+		if err == bookmarks.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.String(), http.StatusInternalServerError)
+			return
+		}
+		tags = bookmarks.QueryTags(strings.SplitN(expanded, " ", 2)[0])
+	}
+	if q != "" || format == "epub" {
+		tags = settings.HideTags(tags)
+	}
+
+	// The EPUB bundles the unread articles of the query
+	if format == "epub" {
+		tags = append(tags, bookmarks.StatePrefix+bookmarks.StateUnread)
+	}
+
+	marks, err := bookmarks.ByTags(c, tags)
 	if err != nil {
 		http.Error(w, err.String(), http.StatusInternalServerError)
 		return
 	}
 
+	if format == "epub" {
+		bookmarks.SortByAdded(marks)
+		title := "Reading list"
+		if q != "" {
+			title += " '" + q + "'"
+		}
+		exportEPUB(c, w, title, marks)
+		return
+	}
+
 	// TODO: export view
 	output(c, w, "export", map[string]interface{}{
 		"count": len(marks),
@@ -223,25 +618,67 @@ func handleBookmarklet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The bookmarklet is loaded as a script from foreign pages, so it can't
+	// carry a CSRF token; instead it embeds a token signed for this user.
+	settings, err := bookmarks.CurrentSettings(c)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	if !checkToken(c, bookmarkletPurpose(settings), u, r.FormValue("token")) {
+		http.Error(w, "Invalid bookmarklet token", http.StatusForbidden)
+		return
+	}
+
 	url := r.FormValue("url")
 	title:= r.FormValue("title")
 	tagString := r.FormValue("tags")
 	tags := strings.Split(tagString, ",")
 
+	// The "Read later" bookmarklet puts the page on the reading list
 	bm := bookmarks.NewBookmark(u, url, title, tags)
-	_, err := bm.Save(c)
+	bm.ReadState = r.FormValue("state")
+	_, err = bm.Save(c)
 	if err != nil {
-		http.Error(w, err.String(), http.StatusInternalServerError)
+		saveError(w, err)
 		return
 	}
 
+	message := "Bin o'Bookmarked '" + title + "'!"
+	if bm.Unread() {
+		message = "Added '" + title + "' to your reading list!"
+	}
+
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
 	output(c, w, "bookmarklet_save", map[string]interface{}{
 		"url": url,
 		"title": title,
 		"tags": tags,
+		"message": jsString(message),
 	})
 }
 
+// saveError reports a failed bookmarks.Save, distinguishing invalid input
+// from datastore failures.
+func saveError(w http.ResponseWriter, err os.Error) {
+	if err == bookmarks.ErrInvalidScheme || err == bookmarks.ErrInvalidMethod || err == bookmarks.ErrInvalidState {
+		http.Error(w, err.String(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.String(), http.StatusInternalServerError)
+}
+
+// redirectToLogin sends anonymous users to the login page, returning to the
+// requested page afterwards.
+func redirectToLogin(c appengine.Context, w http.ResponseWriter, r *http.Request) {
+	loginURL, err := user.LoginURL(c, rootURL(c)+r.URL.RawPath)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, loginURL, http.StatusFound)
+}
+
 func rootURL(c appengine.Context) string {
 	return "http://" + appengine.DefaultVersionHostname(c)
 }
@@ -251,6 +688,12 @@ func render(view string, context ...interface{}) string {
 }
 
 func output(c appengine.Context, w http.ResponseWriter, view string, context ...interface{}) {
+	outputPage(c, w, nil, view, context...)
+}
+
+// outputPage renders a view like output, additionally allowing the page's
+// forms to be submitted to formTargets (origins like "https://example.com").
+func outputPage(c appengine.Context, w http.ResponseWriter, formTargets []string, view string, context ...interface{}) {
 	// Get user info
 	u := user.Current(c)
 	loginURL, err := user.LoginURL(c, rootURL(c))
@@ -264,11 +707,39 @@ func output(c appengine.Context, w http.ResponseWriter, view string, context ...
 		return
 	}
 
+	// Tokens for forms and bookmarklets of the logged-in user
+	csrfToken, bookmarkletToken := "", ""
+	if u != nil {
+		var settings bookmarks.Settings
+		if settings, err = bookmarks.CurrentSettings(c); err == nil {
+			csrfToken, err = signToken(c, purposeCSRF, u)
+		}
+		if err == nil {
+			bookmarkletToken, err = signToken(c, bookmarkletPurpose(settings), u)
+		}
+		if err != nil {
+			http.Error(w, err.String(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Allow the scripts of this page through the Content-Security-Policy
+	nonce, err := newNonce()
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Security-Policy", contentSecurityPolicy(nonce, formTargets...))
+
 	context = append(context, map[string]interface{}{
+		"cspNonce": nonce,
+		"jqueryURL": jqueryURL,
 		"user": u,
 		"loginURL": loginURL,
 		"logoutURL": logoutURL,
 		"rootURL": rootURL(c),
+		"csrfToken": csrfToken,
+		"bookmarkletToken": bookmarkletToken,
 	})
 	fmt.Fprintln(w, render(view, context...))
 }
@@ -0,0 +1,129 @@
+/*
+	bulk.go - bulk operation pages for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"appengine/user"
+	"bookmarks"
+	"http"
+	"strings"
+)
+
+func init() {
+	http.HandleFunc("/bulk", secure(handleBulk))
+	http.HandleFunc("/bulk/undo", secure(handleBulkUndo))
+}
+
+// handleBulk applies an operation to all bookmarks matching the tag list q,
+// as listed by the index. Without "confirm", it only shows how many
+// bookmarks would be affected.
+func handleBulk(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		return
+	}
+	if !requirePost(c, w, r, u) {
+		return
+	}
+
+	// An empty query would match the whole collection
+	tagString := r.FormValue("q")
+	if len(bookmarks.ParseTags(tagString)) == 0 {
+		http.Error(w, "Bulk operations need a tag query", http.StatusBadRequest)
+		return
+	}
+	op := bookmarks.BulkOp{
+		Op: r.FormValue("op"),
+		Tags: bookmarks.ParseTags(r.FormValue("tags")),
+		From: strings.TrimSpace(r.FormValue("from")),
+		To: strings.TrimSpace(r.FormValue("to")),
+	}
+
+	settings, err := bookmarks.CurrentSettings(c)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	marks, err := bookmarks.ByTags(c, settings.HideTags(strings.Split(tagString, ",")))
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.FormValue("confirm") == "" {
+		count := len(op.Affected(marks))
+		output(c, w, "bulk", map[string]interface{}{
+			"title": "Confirm: " + op.Op + " " + pluralize("bookmark", count, true),
+			"confirm": true,
+			"count": count,
+			"q": tagString,
+			"op": op.Op,
+			"tags": r.FormValue("tags"),
+			"from": op.From,
+			"to": op.To,
+		})
+		return
+	}
+
+	count, err := bookmarks.Bulk(c, marks, op)
+	if err == bookmarks.ErrInvalidBulkOp || err == bookmarks.ErrTooManyBookmarks {
+		http.Error(w, err.String(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	output(c, w, "bulk", map[string]interface{}{
+		"title": "Done: " + op.Op + " " + pluralize("bookmark", count, true),
+		"done": true,
+		"count": count,
+	})
+}
+
+// handleBulkUndo reverts the last bulk operation.
+func handleBulkUndo(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		return
+	}
+	if !requirePost(c, w, r, u) {
+		return
+	}
+
+	count, err := bookmarks.Undo(c)
+	if err == bookmarks.ErrNothingToUndo {
+		http.Error(w, err.String(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	output(c, w, "bulk", map[string]interface{}{
+		"title": "Restored " + pluralize("bookmark", count, true),
+		"count": count,
+	})
+}
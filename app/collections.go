@@ -0,0 +1,197 @@
+/*
+	collections.go - saved searches for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"appengine/user"
+	"bookmarks"
+	"http"
+	"os"
+	"strings"
+)
+
+func init() {
+	http.HandleFunc("/c/", secure(handleCollection))
+	http.HandleFunc("/collections", secure(handleCollections))
+	http.HandleFunc("/collections/delete", secure(handleCollectionDelete))
+}
+
+// handleCollection lists the bookmarks of the saved search /c/{name}.
+func handleCollection(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		redirectToLogin(c, w, r)
+		return
+	}
+
+	name := r.URL.Path[len("/c/"):]
+	if _, err := bookmarks.CollectionByName(c, name); err != nil {
+		if err == bookmarks.ErrNotFound {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, err.String(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	r.ParseForm()
+	r.Form.Set("q", "@"+name+",-follow")
+	handleIndex(w, r)
+}
+
+// expandCollections replaces the "@name" tags of a Follow query by the tags
+// of the current user's saved searches, see expandQuery.
+func expandCollections(c appengine.Context, fullQuery string) (expanded, sortOrder string, err os.Error) {
+	return expandQuery(fullQuery, func(name string) (bookmarks.Collection, os.Error) {
+		return bookmarks.CollectionByName(c, name)
+	})
+}
+
+// expandQuery replaces the "@name" tags of a Follow query by the tags of the
+// saved searches looked up by name. Their search terms and sort order are
+// used unless the query has its own search terms. A "?" on any of them or
+// on the whole tag list picks one of all matches at random, so it ends up
+// once at the end of the expanded tag list.
+func expandQuery(fullQuery string, lookup func(name string) (bookmarks.Collection, os.Error)) (expanded, sortOrder string, err os.Error) {
+	parts := strings.SplitN(fullQuery, " ", 2)
+	if !strings.Contains(parts[0], "@") {
+		return fullQuery, "", nil
+	}
+	query := ""
+	if len(parts) > 1 {
+		query = parts[1]
+	}
+
+	random := strings.HasSuffix(parts[0], "?")
+	var tags []string
+	for _, tag := range strings.Split(strings.TrimRight(parts[0], "?"), ",") {
+		if !strings.HasPrefix(tag, "@") {
+			tags = append(tags, tag)
+			continue
+		}
+		name := strings.TrimRight(tag[1:], "?")
+		random = random || name != tag[1:]
+		col, err := lookup(name)
+		if err != nil {
+			return fullQuery, "", err
+		}
+		colTags, colQuery := col.Split()
+		random = random || strings.HasSuffix(colTags, "?")
+		if colTags = strings.TrimRight(colTags, "?"); colTags != "" {
+			tags = append(tags, colTags)
+		}
+		if query == "" {
+			query = colQuery
+		}
+		if sortOrder == "" {
+			sortOrder = col.Sort
+		}
+	}
+
+	expanded = strings.Join(tags, ",")
+	if random {
+		expanded += "?"
+	}
+	if query != "" {
+		expanded += " " + query
+	}
+	return expanded, sortOrder, nil
+}
+
+// countCollections returns the saved searches with the number of bookmarks
+// they currently match.
+func countCollections(c appengine.Context, settings bookmarks.Settings, loaded *userBookmarks) ([]bookmarks.Collection, os.Error) {
+	cols, err := bookmarks.Collections(c)
+	if err != nil || len(cols) == 0 {
+		return cols, err
+	}
+	all, err := loaded.all()
+	if err != nil {
+		return nil, err
+	}
+	for i := range cols {
+		cols[i].Count = bookmarks.CountMatches(all, settings.HideTags(cols[i].Tags()))
+	}
+	return cols, nil
+}
+
+// handleCollections lists the saved searches and saves a new one on POST.
+func handleCollections(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		redirectToLogin(c, w, r)
+		return
+	}
+
+	if r.Method == "POST" {
+		if !requirePost(c, w, r, u) {
+			return
+		}
+		col := bookmarks.NewCollection(u, r.FormValue("name"), r.FormValue("q"), r.FormValue("sort"))
+		if err := col.Save(c); err != nil {
+			switch err {
+			case bookmarks.ErrInvalidCollection, bookmarks.ErrInvalidSort:
+				http.Error(w, err.String(), http.StatusBadRequest)
+			default:
+				http.Error(w, err.String(), http.StatusInternalServerError)
+			}
+			return
+		}
+		http.Redirect(w, r, rootURL(c)+"/c/"+col.Name, http.StatusFound)
+		return
+	}
+
+	settings, err := bookmarks.CurrentSettings(c)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	cols, err := countCollections(c, settings, newUserBookmarks(c))
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	output(c, w, "collections", map[string]interface{}{
+		"title": pluralize("Saved search", len(cols), true),
+		"collections": cols,
+	})
+}
+
+func handleCollectionDelete(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		return
+	}
+	if !requirePost(c, w, r, u) {
+		return
+	}
+
+	if err := bookmarks.DeleteCollection(c, r.FormValue("name")); err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, rootURL(c)+"/collections", http.StatusFound)
+}
@@ -0,0 +1,69 @@
+/*
+	collections_test.go - tests for the saved searches of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"bookmarks"
+	"os"
+	"testing"
+)
+
+var testCollections = map[string]bookmarks.Collection{
+	"work":  {Name: "work", Query: "work,-hidden jira", Sort: bookmarks.SortFrecency},
+	"music": {Name: "music", Query: "music,jazz"},
+	"lucky": {Name: "lucky", Query: "fun?"},
+}
+
+func lookupCollection(name string) (bookmarks.Collection, os.Error) {
+	col, ok := testCollections[name]
+	if !ok {
+		return col, bookmarks.ErrNotFound
+	}
+	return col, nil
+}
+
+func TestExpandQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expanded string
+		sort     string
+	}{
+		{"go,work terms", "go,work terms", ""},
+		{"@work", "work,-hidden jira", bookmarks.SortFrecency},
+		{"@work own terms", "work,-hidden own terms", bookmarks.SortFrecency},
+		{"@music,-follow", "music,jazz,-follow", ""},
+		{"@music?", "music,jazz?", ""},
+		{"@music?,go", "music,jazz,go?", ""},
+		{"go,@music", "go,music,jazz", ""},
+		{"@music,go?", "music,jazz,go?", ""},
+		{"@music?,@work?", "music,jazz,work,-hidden? jira", bookmarks.SortFrecency},
+		{"@lucky,go", "fun,go?", ""},
+	}
+	for _, test := range tests {
+		expanded, sortOrder, err := expandQuery(test.query, lookupCollection)
+		if err != nil || expanded != test.expanded || sortOrder != test.sort {
+			t.Errorf("expandQuery(%q) = %q, %q, %v, want %q, %q", test.query, expanded, sortOrder, err, test.expanded, test.sort)
+		}
+	}
+
+	if _, _, err := expandQuery("@missing,go", lookupCollection); err != bookmarks.ErrNotFound {
+		t.Errorf("expandQuery with an unknown name: got %v, want ErrNotFound", err)
+	}
+}
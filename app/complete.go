@@ -0,0 +1,81 @@
+/*
+	complete.go - tag completion for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"appengine/user"
+	"bookmarks"
+	"http"
+	"json"
+)
+
+func init() {
+	http.HandleFunc("/tags/complete", secure(handleTagComplete))
+	http.HandleFunc("/bookmarklet/popup", secure(handleBookmarkletPopup))
+}
+
+// handleTagComplete returns completions for the last tag of a
+// comma-separated tag list (?q=coding,!li) as JSON, most used tags first.
+func handleTagComplete(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		http.Error(w, "Not logged in", http.StatusForbidden)
+		return
+	}
+
+	marks, err := bookmarks.ByTags(c, []string{})
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	completions := bookmarks.CompleteTagList(bookmarks.CountTags(marks), r.FormValue("q"))
+	if len(completions) > maxSuggestions {
+		completions = completions[:maxSuggestions]
+	}
+
+	result, err := json.Marshal(completions)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(result)
+}
+
+// handleBookmarkletPopup shows the form opened by the generic bookmarklet.
+// Unlike the script bookmarklet, it runs on our own origin and saves through
+// /create with a regular CSRF token.
+func handleBookmarkletPopup(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		redirectToLogin(c, w, r)
+		return
+	}
+
+	output(c, w, "bookmarklet_popup", map[string]interface{}{
+		"url": r.FormValue("url"),
+		"title": r.FormValue("title"),
+		"tags": r.FormValue("tags"),
+	})
+}
@@ -0,0 +1,171 @@
+/*
+	csrf.go - request token signing for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+	"bookmarks"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"http"
+	"io"
+	"os"
+	"strconv"
+	"url"
+)
+
+// Token purposes. A token signed for one purpose is never accepted for
+// another, so a leaked bookmarklet token can't be used to delete bookmarks.
+const (
+	purposeCSRF        = "csrf"
+	purposeBookmarklet = "bookmarklet"
+)
+
+// Secret is the application-wide signing key, created on first use.
+type Secret struct {
+	Value []byte
+}
+
+var secretCache []byte
+
+func appSecret(c appengine.Context) ([]byte, os.Error) {
+	if secretCache != nil {
+		return secretCache, nil
+	}
+
+	var s Secret
+	key := datastore.NewKey(c, "Secret", "tokens", 0, nil)
+	err := datastore.Get(c, key, &s)
+	if err == datastore.ErrNoSuchEntity {
+		s.Value = make([]byte, 32)
+		if _, err = io.ReadFull(rand.Reader, s.Value); err != nil {
+			return nil, err
+		}
+		_, err = datastore.Put(c, key, &s)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secretCache = s.Value
+	return secretCache, nil
+}
+
+// tokenFor returns the token binding purpose to the user.
+func tokenFor(secret []byte, purpose, userId string) string {
+	h := hmac.NewSHA1(secret)
+	h.Write([]byte(purpose + ":" + userId))
+	return hex.EncodeToString(h.Sum())
+}
+
+func validToken(secret []byte, purpose, userId, token string) bool {
+	if token == "" {
+		return false
+	}
+	expected := tokenFor(secret, purpose, userId)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// signToken returns a token binding purpose to the given user.
+func signToken(c appengine.Context, purpose string, u *user.User) (string, os.Error) {
+	secret, err := appSecret(c)
+	if err != nil {
+		return "", err
+	}
+	return tokenFor(secret, purpose, u.Id), nil
+}
+
+func checkToken(c appengine.Context, purpose string, u *user.User, token string) bool {
+	secret, err := appSecret(c)
+	if err != nil {
+		c.Errorf("checkToken: %v", err)
+		return false
+	}
+	return validToken(secret, purpose, u.Id, token)
+}
+
+/*
+	The bookmarklet token can't be single-use: it is part of a bookmark the
+	user installs once and runs on every page they save. It is sent to the
+	pages the bookmarklet runs on, so it only allows saving bookmarks, and
+	its purpose contains a per-user generation. Resetting the token in the
+	settings increments the generation, which revokes all installed
+	bookmarklets at once.
+*/
+
+// bookmarkletPurpose returns the token purpose of the user's current
+// bookmarklets.
+func bookmarkletPurpose(settings bookmarks.Settings) string {
+	return purposeBookmarklet + ":" + strconv.Itoa64(settings.TokenGeneration)
+}
+
+// sameOrigin reports whether the request was not issued by a foreign page.
+// Browsers that don't send an Origin header are covered by the token alone.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	o, err := url.Parse(origin)
+	return err == nil && o.Host == r.Host
+}
+
+// checkPost returns the status a mutating request must be rejected with, or
+// 0 if it is a POST with a valid CSRF token from one of our own forms.
+func checkPost(r *http.Request, secret []byte, userId string) int {
+	if r.Method != "POST" {
+		return http.StatusMethodNotAllowed
+	}
+	// API clients may send the token as a header instead
+	token := r.FormValue("csrf")
+	if token == "" {
+		token = r.Header.Get("X-CSRF-Token")
+	}
+	if !sameOrigin(r) || !validToken(secret, purposeCSRF, userId, token) {
+		return http.StatusForbidden
+	}
+	return 0
+}
+
+// requirePost checks that a mutating request is a POST with a valid CSRF
+// token from one of our own forms. It writes the error response itself and
+// returns false if the request must be rejected.
+func requirePost(c appengine.Context, w http.ResponseWriter, r *http.Request, u *user.User) bool {
+	secret, err := appSecret(c)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return false
+	}
+
+	switch checkPost(r, secret, u.Id) {
+	case http.StatusMethodNotAllowed:
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	case http.StatusForbidden:
+		http.Error(w, "Invalid request token", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+/*
+	csrf_test.go - tests for the request checks of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"bookmarks"
+	"http"
+	"strings"
+	"testing"
+	"url"
+)
+
+var testSecret = []byte("test secret")
+
+const testUser = "12345"
+
+func newPost(t *testing.T, path string, form url.Values) *http.Request {
+	r, err := http.NewRequest("POST", "http://example.com"+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestCheckPostMethod(t *testing.T) {
+	for _, path := range []string{"/delete?id=1", "/create?url=http://example.org/"} {
+		r, err := http.NewRequest("GET", "http://example.com"+path, nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		if status := checkPost(r, testSecret, testUser); status != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s: got status %d, want %d", path, status, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func TestCheckPostToken(t *testing.T) {
+	valid := tokenFor(testSecret, purposeCSRF, testUser)
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"missing token", "", http.StatusForbidden},
+		{"wrong token", "0123456789abcdef", http.StatusForbidden},
+		{"other user", tokenFor(testSecret, purposeCSRF, "54321"), http.StatusForbidden},
+		{"bookmarklet token", tokenFor(testSecret, purposeBookmarklet+":0", testUser), http.StatusForbidden},
+		{"valid token", valid, 0},
+	}
+
+	for _, path := range []string{"/delete", "/create"} {
+		for _, test := range tests {
+			form := url.Values{"id": {"1"}}
+			if test.token != "" {
+				form.Set("csrf", test.token)
+			}
+			r := newPost(t, path, form)
+			if status := checkPost(r, testSecret, testUser); status != test.want {
+				t.Errorf("POST %s with %s: got status %d, want %d", path, test.name, status, test.want)
+			}
+		}
+	}
+}
+
+func TestCheckPostHeaderToken(t *testing.T) {
+	r := newPost(t, "/api/settings", url.Values{"startQuery": {"work"}})
+	r.Header.Set("X-CSRF-Token", tokenFor(testSecret, purposeCSRF, testUser))
+	if status := checkPost(r, testSecret, testUser); status != 0 {
+		t.Errorf("token in header: got status %d, want 0", status)
+	}
+}
+
+func TestCheckPostOrigin(t *testing.T) {
+	form := url.Values{"csrf": {tokenFor(testSecret, purposeCSRF, testUser)}}
+
+	r := newPost(t, "/delete", form)
+	r.Header.Set("Origin", "http://evil.example.org")
+	if status := checkPost(r, testSecret, testUser); status != http.StatusForbidden {
+		t.Errorf("foreign origin: got status %d, want %d", status, http.StatusForbidden)
+	}
+
+	r = newPost(t, "/delete", form)
+	r.Header.Set("Origin", "http://example.com")
+	if status := checkPost(r, testSecret, testUser); status != 0 {
+		t.Errorf("same origin: got status %d, want 0", status)
+	}
+}
+
+func TestBookmarkletTokenRevoked(t *testing.T) {
+	settings := bookmarks.Settings{UserId: testUser}
+	old := tokenFor(testSecret, bookmarkletPurpose(settings), testUser)
+	if !validToken(testSecret, bookmarkletPurpose(settings), testUser, old) {
+		t.Errorf("token rejected for its own generation")
+	}
+	settings.TokenGeneration++
+	if validToken(testSecret, bookmarkletPurpose(settings), testUser, old) {
+		t.Errorf("token accepted after reset")
+	}
+}
@@ -0,0 +1,132 @@
+/*
+	dashboard.go - multi-section start page for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"appengine/user"
+	"bookmarks"
+	"http"
+	"os"
+	"strings"
+	"url"
+)
+
+func init() {
+	http.HandleFunc("/dashboard", secure(handleDashboard))
+}
+
+func handleDashboard(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		redirectToLogin(c, w, r)
+		return
+	}
+
+	settings, err := bookmarks.CurrentSettings(c)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	outputDashboard(c, w, settings)
+}
+
+// outputDashboard renders the dashboard sections of the user's settings.
+func outputDashboard(c appengine.Context, w http.ResponseWriter, settings bookmarks.Settings) {
+	sections, err := bookmarks.ParseDashboard(settings.Dashboard)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]map[string]interface{}, 0, len(sections))
+	for _, s := range sections {
+		view, err := dashboardSection(c, settings, s)
+		if err == bookmarks.ErrNotFound {
+			view = map[string]interface{}{
+				"title": s.Title,
+				"notice": "Saved search in '" + s.Query + "' not found.",
+			}
+		} else if err != nil {
+			http.Error(w, err.String(), http.StatusInternalServerError)
+			return
+		}
+		views = append(views, view)
+	}
+
+	output(c, w, "dashboard", map[string]interface{}{
+		"title": "Dashboard",
+		"sections": views,
+		"configured": len(sections) > 0,
+	})
+}
+
+// dashboardSection lists the bookmarks of a section like a listing of its
+// query would, cut down to the section's limit.
+func dashboardSection(c appengine.Context, settings bookmarks.Settings, s bookmarks.DashboardSection) (map[string]interface{}, os.Error) {
+	expanded, sortOrder, err := expandCollections(c, s.Query)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(expanded, " ", 2)
+	query := ""
+	if len(parts) > 1 {
+		query = parts[1]
+	}
+
+	marks, err := bookmarks.ByTags(c, settings.HideTags(bookmarks.QueryTags(parts[0])))
+	if err != nil {
+		return nil, err
+	}
+	for i := range marks {
+		marks[i].Query = query
+	}
+
+	if s.Sort != "" {
+		sortOrder = s.Sort
+	}
+	if sortOrder == "" {
+		sortOrder = settings.DefaultSort
+	}
+	bookmarks.SortBy(marks, sortOrder)
+
+	more := 0
+	if len(marks) > s.Limit {
+		more = len(marks) - s.Limit
+		marks = marks[:s.Limit]
+	}
+
+	// The whole listing, without redirecting to a single match
+	listQuery := s.Query
+	if i := strings.Index(listQuery, " "); i >= 0 {
+		listQuery = listQuery[:i] + ",-follow" + listQuery[i:]
+	} else {
+		listQuery += ",-follow"
+	}
+
+	return map[string]interface{}{
+		"title": s.Title,
+		"listURL": "/?q=" + url.QueryEscape(listQuery) + "&sort=" + url.QueryEscape(sortOrder),
+		"bookmarks": marks,
+		"more": more,
+		"hasMore": more > 0,
+	}, nil
+}
@@ -0,0 +1,146 @@
+/*
+	epub.go - EPUB export of the reading list for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"appengine/user"
+	"archive/zip"
+	"bookmarks"
+	"bytes"
+	"fmt"
+	"http"
+	"io"
+	"os"
+	"time"
+)
+
+// Maximum number of articles in one EPUB, which is built in memory
+const maxEPUBArticles = 50
+
+// epubChapter is an article of the EPUB, see views/epub_chapter.mustache.
+type epubChapter struct {
+	Id     string
+	File   string
+	Order  int
+	Title  string
+	URL    string
+	Blocks []bookmarks.ArticleBlock
+}
+
+// exportEPUB sends the articles of the bookmarks as one EPUB book, with a
+// table of contents in their order. Only articles extracted already are
+// included; the others are queued for extraction and listed in the table
+// of contents, so they are part of the next export. Pages whose extraction
+// failed recently, and pages that can't be fetched at all, are listed
+// separately and not queued again.
+func exportEPUB(c appengine.Context, w http.ResponseWriter, title string, marks []bookmarks.Bookmark) {
+	var chapters []epubChapter
+	var missing, failed []bookmarks.Bookmark
+	for _, bm := range marks {
+		if len(chapters) == maxEPUBArticles {
+			break
+		}
+		article, err := bookmarks.ArticleOf(c, bm)
+		if err != nil && err != bookmarks.ErrNotFound {
+			http.Error(w, err.String(), http.StatusInternalServerError)
+			return
+		}
+		s := bookmarks.URLScheme(bm.URL)
+		if s != "http" && s != "https" || err == nil && article.Failed() && !article.RetryDue() {
+			if len(failed) < maxEPUBArticles {
+				failed = append(failed, bm)
+			}
+			continue
+		}
+		if err == bookmarks.ErrNotFound || article.Failed() {
+			if len(missing) < maxEPUBArticles {
+				bookmarks.ExtractLater(c, bm.Id)
+				missing = append(missing, bm)
+			}
+			continue
+		}
+
+		n := len(chapters) + 1
+		chapters = append(chapters, epubChapter{
+			Id: fmt.Sprintf("chapter%d", n),
+			File: fmt.Sprintf("chapter%d.xhtml", n),
+			Order: n + 1, // after the table of contents
+			Title: article.Title,
+			URL: bm.SafeURL(),
+			Blocks: article.Blocks(),
+		})
+	}
+
+	u := user.Current(c)
+	book := map[string]interface{}{
+		"title": title,
+		"author": u.String(),
+		"date": time.UTC().Format("2006-01-02"),
+		"identifier": fmt.Sprintf("urn:bin-o-bookmarks:%s:%d", u.Id, time.Seconds()),
+		"chapters": chapters,
+		"missing": missing,
+		"hasMissing": len(missing) > 0,
+		"failed": failed,
+		"hasFailed": len(failed) > 0,
+	}
+
+	// The mimetype has to come first, uncompressed
+	files := []struct{ name, content string }{
+		{"mimetype", "application/epub+zip"},
+		{"META-INF/container.xml", render("epub_container")},
+		{"OEBPS/content.opf", render("epub_opf", book)},
+		{"OEBPS/toc.ncx", render("epub_ncx", book)},
+		{"OEBPS/toc.xhtml", render("epub_toc", book)},
+	}
+	for _, ch := range chapters {
+		files = append(files, struct{ name, content string }{"OEBPS/" + ch.File, render("epub_chapter", ch)})
+	}
+
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	for i, file := range files {
+		header := &zip.FileHeader{Name: file.name, Method: zip.Deflate}
+		if i == 0 {
+			header.Method = zip.Store
+		}
+		if err := writeZipFile(z, header, file.content); err != nil {
+			http.Error(w, err.String(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := z.Close(); err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/epub+zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="reading-list.epub"`)
+	w.Write(buf.Bytes())
+}
+
+func writeZipFile(z *zip.Writer, header *zip.FileHeader, content string) os.Error {
+	f, err := z.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, content)
+	return err
+}
@@ -0,0 +1,56 @@
+/*
+	escape.go - context-aware escaping for Bin o'Bookmarks views
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"url"
+)
+
+// Mustache only knows HTML escaping. Values that end up in JavaScript or
+// javascript: URLs have to be prepared here and rendered raw ({{{...}}}).
+
+// jsString returns s as a quoted JavaScript string literal that is safe to
+// embed in a script, an inline event handler or an HTML attribute.
+func jsString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '\\', r == '"', r == '\'', r == '<', r == '>', r == '&', r == '/':
+			fmt.Fprintf(&buf, "\\u%04x", r)
+		case r < 0x20, r == 0x2028, r == 0x2029:
+			fmt.Fprintf(&buf, "\\u%04x", r)
+		default:
+			buf.WriteString(string(r))
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// bookmarkletArg escapes s for use as a query parameter inside a string
+// literal of a javascript: link. The browser percent-decodes the link once
+// before running it, so the query escapes are protected by a second level.
+func bookmarkletArg(s string) string {
+	return strings.Replace(url.QueryEscape(s), "%", "%25", -1)
+}
@@ -0,0 +1,99 @@
+/*
+	fallback.go - Follow-mode fallback chains for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"bookmarks"
+	"os"
+	"strings"
+	"time"
+)
+
+// fallbackResult is what a step of the fallback chain found.
+type fallbackResult struct {
+	marks     []bookmarks.Bookmark
+	tagString string
+	query     string
+	redirect  bool
+}
+
+// runFallbacks tries the steps of the fallback chain in order until one
+// finds bookmarks for the tags and search query that matched nothing. If no
+// step finds any, the result is empty.
+func runFallbacks(c appengine.Context, settings bookmarks.Settings, loaded *userBookmarks, steps []bookmarks.FallbackStep, tags []string, query, fullQuery string) (res fallbackResult, err os.Error) {
+	for _, step := range steps {
+		res = fallbackResult{redirect: step.Redirect}
+		switch step.Kind {
+		case bookmarks.FallbackPrefix:
+			prefix := ""
+			for _, tag := range tags {
+				if tag != "" && tag[0] != '-' {
+					prefix = strings.TrimLeft(tag, "!")
+					break
+				}
+			}
+			if prefix == "" {
+				continue
+			}
+			all, err := loaded.all()
+			if err != nil {
+				return res, err
+			}
+			for _, b := range bookmarks.Match(all, settings.HideTags([]string{})) {
+				for _, tag := range b.Tags {
+					if strings.HasPrefix(tag, prefix) {
+						res.marks = append(res.marks, b)
+						break
+					}
+				}
+			}
+			res.tagString, res.query = prefix+"*", query
+
+		case bookmarks.FallbackTag:
+			tag := step.Arg
+			if tag == "" {
+				tag = settings.FallbackTag
+			}
+			res.marks, err = bookmarks.ByTags(c, settings.HideTags([]string{tag}))
+			if err != nil {
+				return res, err
+			}
+			res.tagString, res.query = tag, fullQuery
+
+		case bookmarks.FallbackEngine:
+			if fullQuery == "" {
+				continue
+			}
+			// The search isn't a stored bookmark, so it is expanded here
+			// and listed without edit controls
+			res.marks = []bookmarks.Bookmark{{
+				URL:   bookmarks.FormatURL(step.Arg, fullQuery, time.Seconds()),
+				Title: "Search for '" + fullQuery + "'",
+			}}
+			res.tagString, res.query = strings.Join(tags, ","), query
+		}
+
+		if len(res.marks) > 0 {
+			return res, nil
+		}
+	}
+	return fallbackResult{}, nil
+}
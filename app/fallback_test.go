@@ -0,0 +1,47 @@
+/*
+	fallback_test.go - tests for the Follow-mode fallbacks of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"bookmarks"
+	"testing"
+)
+
+func TestEngineFallback(t *testing.T) {
+	// Engine steps don't use the datastore
+	steps := []bookmarks.FallbackStep{{Kind: bookmarks.FallbackEngine, Arg: "http://example.com/?q=%s"}}
+	settings := bookmarks.Settings{UserId: testUser}
+
+	res, err := runFallbacks(nil, settings, nil, steps, []string{"wiki"}, "go tour", "wiki go tour")
+	if err != nil {
+		t.Fatalf("runFallbacks: %v", err)
+	}
+	if len(res.marks) != 1 || res.marks[0].Stored() || res.marks[0].Query != "" {
+		t.Fatalf("runFallbacks found %v, want one unsaved search", res.marks)
+	}
+	if res.tagString != "wiki" || res.query != "go tour" {
+		t.Errorf("runFallbacks = %q, %q, want %q, %q", res.tagString, res.query, "wiki", "go tour")
+	}
+
+	res, err = runFallbacks(nil, settings, nil, steps, []string{""}, "", "")
+	if err != nil || len(res.marks) != 0 || res.tagString != "" {
+		t.Errorf("runFallbacks without a query = %v, %v, want an empty result", res, err)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+	favicon.go - self-hosted favicons for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"appengine/user"
+	"bookmarks"
+	"fmt"
+	"hash/crc32"
+	"http"
+	"strconv"
+	"strings"
+)
+
+// Background colors of placeholder icons
+var placeholderColors = []string{"#d40", "#5af", "#6a5", "#a5c", "#c93", "#578"}
+
+func init() {
+	http.HandleFunc("/favicon/", secure(handleFavicon))
+}
+
+// handleFavicon serves the icon of /favicon/{domain} from the cache, so the
+// domains we bookmark aren't sent to a third party. Domains without an icon
+// get a placeholder with their initial. If the icon is missing or expired
+// and ?id= names one of the user's bookmarks on the domain, it is fetched
+// in the background.
+func handleFavicon(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		http.Error(w, "Not logged in", http.StatusForbidden)
+		return
+	}
+
+	domain := strings.ToLower(r.URL.Path[len("/favicon/"):])
+	f, err := bookmarks.CachedFavicon(c, domain)
+	switch {
+	case err == bookmarks.ErrInvalidDomain:
+	case err == bookmarks.ErrNotFound || err == nil && f.Expired():
+		if id, err := strconv.Atoi64(r.FormValue("id")); err == nil {
+			if bm, err := bookmarks.ByID(c, id); err == nil && bm.Domain() == domain {
+				if err = bookmarks.RefreshFavicon(c, domain); err != nil {
+					c.Errorf("handleFavicon: %s: %v", domain, err)
+				}
+			}
+		}
+	case err != nil:
+		c.Errorf("handleFavicon: %s: %v", domain, err)
+	}
+
+	if err == nil && f.Found() {
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		w.Header().Set("Content-Type", f.ContentType)
+		w.Write(f.Data)
+		return
+	}
+	// The icon may be cached soon
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	writePlaceholderIcon(w, domain)
+}
+
+// writePlaceholderIcon draws the initial of the domain on a background
+// color picked by the domain.
+func writePlaceholderIcon(w http.ResponseWriter, domain string) {
+	initial := "?"
+	if bookmarks.ValidDomain(domain) {
+		name := domain
+		if strings.HasPrefix(name, "www.") && len(name) > len("www.") {
+			name = name[len("www."):]
+		}
+		initial = strings.ToUpper(name[:1])
+	}
+	color := placeholderColors[crc32.ChecksumIEEE([]byte(domain))%uint32(len(placeholderColors))]
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 16 16">`+
+		`<rect width="16" height="16" rx="3" fill="%s"/>`+
+		`<text x="8" y="12" font-family="Helvetica, Arial, sans-serif" font-size="11" text-anchor="middle" fill="#fff">%s</text>`+
+		`</svg>`, color, initial)
+}
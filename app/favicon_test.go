@@ -0,0 +1,87 @@
+/*
+	favicon_test.go - tests for the favicon handler of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"bookmarks"
+	"http/httptest"
+	"strings"
+	"testing"
+)
+
+func placeholder(domain string) (contentType, body string) {
+	w := httptest.NewRecorder()
+	writePlaceholderIcon(w, domain)
+	return w.Header().Get("Content-Type"), w.Body.String()
+}
+
+func TestPlaceholderIcon(t *testing.T) {
+	tests := []struct {
+		domain  string
+		initial string
+	}{
+		{"example.com", ">E</text>"},
+		{"www.golang.org", ">G</text>"},
+		{"www.", ">W</text>"},
+		{"<script>", ">?</text>"},
+		{"", ">?</text>"},
+	}
+	for _, test := range tests {
+		contentType, body := placeholder(test.domain)
+		if contentType != "image/svg+xml" {
+			t.Errorf("%q: Content-Type = %q, want image/svg+xml", test.domain, contentType)
+		}
+		if !strings.Contains(body, test.initial) {
+			t.Errorf("%q: icon %s doesn't contain %s", test.domain, body, test.initial)
+		}
+		if strings.Contains(body, "<script") {
+			t.Errorf("%q: domain written into the icon: %s", test.domain, body)
+		}
+	}
+}
+
+func TestPlaceholderWithoutDomain(t *testing.T) {
+	path := bookmarks.Bookmark{Id: 7, URL: "mailto:someone@example.com"}.FaviconURL()
+	domain := path[len("/favicon/"):]
+	if bookmarks.ValidDomain(domain) {
+		t.Errorf("FaviconURL %q of a bookmark without a domain names a valid domain", path)
+	}
+	if _, body := placeholder(domain); !strings.Contains(body, ">?</text>") {
+		t.Errorf("placeholder of %q = %s, want a question mark", path, body)
+	}
+}
+
+func TestPlaceholderColor(t *testing.T) {
+	_, first := placeholder("example.com")
+	_, second := placeholder("example.com")
+	if first != second {
+		t.Errorf("placeholder of the same domain changed: %s and %s", first, second)
+	}
+
+	found := false
+	for _, color := range placeholderColors {
+		if strings.Contains(first, `fill="`+color+`"`) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("placeholder %s doesn't use one of %v", first, placeholderColors)
+	}
+}
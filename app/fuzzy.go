@@ -0,0 +1,84 @@
+/*
+	fuzzy.go - forgiving tag matching in Follow mode for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"bookmarks"
+	"strings"
+	"url"
+)
+
+// Maximum number of "did you mean" suggestions
+const maxSimilar = 3
+
+// resolveTags replaces tags that don't exist by the only tag starting with
+// them, so "gh" finds "github". Negated tags are kept as they are. It
+// reports whether all unknown tags could be resolved.
+func resolveTags(counts []bookmarks.TagCount, tags []string) ([]string, bool) {
+	resolved := make([]string, len(tags))
+	for i, tag := range tags {
+		resolved[i] = tag
+		if tag == "" || tag[0] == '-' || strings.HasPrefix(tag, bookmarks.StatePrefix) {
+			continue
+		}
+		op, name := "", tag
+		if name[0] == '!' {
+			op, name = "!", name[1:]
+		}
+		full, ok := bookmarks.ResolvePrefix(counts, name)
+		if !ok {
+			return tags, false
+		}
+		resolved[i] = op + full
+	}
+	return resolved, true
+}
+
+// similarQueries suggests queries with an unknown tag replaced by a similar
+// existing one.
+func similarQueries(counts []bookmarks.TagCount, tags []string, query string) []map[string]string {
+	known := make(map[string]bool)
+	for _, tag := range counts {
+		known[tag.Name] = true
+	}
+
+	var suggestions []map[string]string
+	for i, tag := range tags {
+		op, name := "", tag
+		if name != "" && (name[0] == '!' || name[0] == '-') {
+			op, name = name[:1], name[1:]
+		}
+		if name == "" || known[name] || strings.HasPrefix(name, bookmarks.StatePrefix) {
+			continue
+		}
+		for _, similar := range bookmarks.SimilarTags(counts, name, maxSimilar) {
+			replaced := append(append(append([]string{}, tags[:i]...), op+similar), tags[i+1:]...)
+			q := strings.Join(replaced, ",")
+			if query != "" {
+				q += " " + query
+			}
+			suggestions = append(suggestions, map[string]string{
+				"query": q,
+				"queryArg": url.QueryEscape(q),
+			})
+		}
+	}
+	return suggestions
+}
@@ -0,0 +1,51 @@
+/*
+	fuzzy_test.go - tests for the Follow-mode tag suggestions of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"bookmarks"
+	"strings"
+	"testing"
+)
+
+var testCounts = []bookmarks.TagCount{{"github", 3}, {"golang", 2}, {"go", 1}, {"music", 1}}
+
+func TestResolveTags(t *testing.T) {
+	tags, ok := resolveTags(testCounts, []string{"gi", "-x", "!mus", "state:unread", ""})
+	if !ok || strings.Join(tags, ",") != "github,-x,!music,state:unread," {
+		t.Errorf("resolveTags = %v, %v", tags, ok)
+	}
+
+	orig := []string{"gi", "g"}
+	tags, ok = resolveTags(testCounts, orig)
+	if ok || strings.Join(tags, ",") != "gi,g" {
+		t.Errorf("resolveTags with an ambiguous prefix = %v, %v", tags, ok)
+	}
+}
+
+func TestSimilarQueries(t *testing.T) {
+	suggestions := similarQueries(testCounts, []string{"go", "-musik"}, "search terms")
+	if len(suggestions) != 1 || suggestions[0]["query"] != "go,-music search terms" {
+		t.Errorf("similarQueries = %v", suggestions)
+	}
+	if len(similarQueries(testCounts, []string{"go", "state:unraed"}, "")) != 0 {
+		t.Errorf("similarQueries suggested a reading state")
+	}
+}
@@ -0,0 +1,112 @@
+/*
+	golinks.go - host-based short links for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"appengine/user"
+	"bookmarks"
+	"http"
+	"strings"
+	"url"
+)
+
+// shortHosts are the host names answered as go links: with the name pointed
+// at this application (e.g. in DNS or the hosts file), http://go/wiki opens
+// the bookmark tagged "wiki" and http://go/gh/org/repo fills "org repo"
+// into the URL of the bookmark tagged "gh".
+var shortHosts = []string{"go"}
+
+func init() {
+	for _, host := range shortHosts {
+		http.HandleFunc(host+"/", secure(handleShortHost))
+	}
+	http.HandleFunc("/golink/", secure(handleGoLink))
+}
+
+// handleShortHost passes a go link on to our main host, where the user is
+// actually logged in.
+func handleShortHost(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	var segments []string
+	for _, s := range strings.Split(r.URL.Path, "/") {
+		if s != "" {
+			segments = append(segments, strings.Replace(url.QueryEscape(s), "+", "%20", -1))
+		}
+	}
+	if len(segments) == 0 {
+		http.Redirect(w, r, rootURL(c), http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, rootURL(c)+"/golink/"+strings.Join(segments, "/"), http.StatusFound)
+}
+
+// handleGoLink resolves /golink/name/args... as a short link or through
+// Follow mode. Unknown names lead to a form for creating the link.
+func handleGoLink(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		redirectToLogin(c, w, r)
+		return
+	}
+
+	var segments []string
+	for _, s := range strings.Split(r.URL.Path[len("/golink/"):], "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	if len(segments) == 0 {
+		http.Redirect(w, r, rootURL(c), http.StatusFound)
+		return
+	}
+	name, query := segments[0], strings.Join(segments[1:], " ")
+
+	// Dedicated short links take precedence over tags
+	if followShortLink(c, w, r, name, query) {
+		return
+	}
+
+	settings, err := bookmarks.CurrentSettings(c)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	marks, err := bookmarks.ByTags(c, settings.HideTags([]string{name}))
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case len(marks) == 0:
+		output(c, w, "create", map[string]interface{}{
+			"title": name,
+			"tags": "!" + name,
+			"notice": "There is no link named '" + name + "' yet. Create it now!",
+		})
+	case len(marks) == 1 && bookmarks.ValidURL(marks[0].URL):
+		marks[0].Query = query
+		follow(c, w, r, marks[0])
+	default:
+		http.Redirect(w, r, rootURL(c)+"/?q="+url.QueryEscape(strings.TrimSpace(name+" "+query)), http.StatusFound)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+	headers.go - security headers for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"http"
+	"io"
+	"os"
+	"strings"
+)
+
+// secure wraps a handler so that every response carries our security
+// headers. The Content-Security-Policy set here locks everything down; pages
+// rendered through output replace it with a policy allowing their scripts.
+func secure(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hdr := w.Header()
+		hdr.Set("Content-Security-Policy", contentSecurityPolicy(""))
+		hdr.Set("X-Frame-Options", "DENY")
+		hdr.Set("X-Content-Type-Options", "nosniff")
+		hdr.Set("Referrer-Policy", "same-origin")
+		hdr.Set("Strict-Transport-Security", "max-age=31536000")
+		h(w, r)
+	}
+}
+
+// jqueryURL is the only script loaded from another host. The policy allows
+// this exact file rather than the whole host, which also serves scripts that
+// could be abused to bypass the nonce.
+const jqueryURL = "https://ajax.googleapis.com/ajax/libs/jquery/1.7.1/jquery.min.js"
+
+// contentSecurityPolicy returns the policy for a response. Without a nonce,
+// nothing may be loaded at all. With a nonce, only our own files, jQuery and
+// script tags carrying the nonce may run, and forms may only be submitted to
+// us and to formTargets. The bookmarklet javascript: links can't be executed
+// on our pages either way; they only run as bookmarks, under the policy of
+// the page they are used on.
+func contentSecurityPolicy(nonce string, formTargets ...string) string {
+	if nonce == "" {
+		return "default-src 'none'; frame-ancestors 'none'"
+	}
+	return "default-src 'self'; " +
+		"script-src 'self' 'nonce-" + nonce + "' " + jqueryURL + "; " +
+		"style-src 'self'; " +
+		"img-src 'self' data:; " +
+		"object-src 'none'; " +
+		"base-uri 'none'; " +
+		"form-action " + strings.Join(append([]string{"'self'"}, formTargets...), " ") + "; " +
+		"frame-ancestors 'none'"
+}
+
+// newNonce returns a fresh random value for the script-src nonce.
+func newNonce() (string, os.Error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,40 @@
+/*
+	headers_test.go - tests for the security headers of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScriptSources(t *testing.T) {
+	policy := contentSecurityPolicy("abc")
+	var sources []string
+	for _, directive := range strings.Split(policy, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) > 0 && fields[0] == "script-src" {
+			sources = fields[1:]
+		}
+	}
+	want := "'self' 'nonce-abc' " + jqueryURL
+	if got := strings.Join(sources, " "); got != want {
+		t.Errorf("script-src = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+	import.go - bulk adding of pasted URL lists for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"appengine/user"
+	"bookmarks"
+	"http"
+)
+
+func init() {
+	http.HandleFunc("/import", secure(handleImport))
+}
+
+// handleImport shows the paste box for URL lists and reports the result of
+// each line after submitting.
+func handleImport(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		redirectToLogin(c, w, r)
+		return
+	}
+
+	if r.Method != "POST" {
+		output(c, w, "import", map[string]interface{}{
+			"title": "Add URL list",
+		})
+		return
+	}
+	if !requirePost(c, w, r, u) {
+		return
+	}
+
+	lines := bookmarks.ParseImport(r.FormValue("urls"))
+	bookmarks.Import(c, u, lines, bookmarks.ParseTags(r.FormValue("tags")))
+
+	counts := make(map[string]int)
+	for _, l := range lines {
+		counts[l.Status]++
+	}
+
+	output(c, w, "import", map[string]interface{}{
+		"title": "Added URL list",
+		"imported": true,
+		"results": lines,
+		"created": counts[bookmarks.ImportCreated],
+		"updated": counts[bookmarks.ImportUpdated],
+		"duplicate": counts[bookmarks.ImportDuplicate],
+		"invalid": counts[bookmarks.ImportInvalid],
+		"skipped": counts[bookmarks.ImportSkipped],
+		"failed": counts[bookmarks.ImportFailed],
+		"urls": r.FormValue("urls"),
+		"tags": r.FormValue("tags"),
+	})
+}
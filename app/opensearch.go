@@ -0,0 +1,132 @@
+/*
+	opensearch.go - OpenSearch description and suggestions for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"appengine/user"
+	"bookmarks"
+	"fmt"
+	"http"
+	"json"
+	"strings"
+)
+
+// Maximum number of suggestions returned
+const maxSuggestions = 10
+
+func init() {
+	http.HandleFunc("/opensearch.xml", secure(handleOpenSearch))
+	http.HandleFunc("/suggest", secure(handleSuggest))
+}
+
+// handleOpenSearch serves the description document that lets browsers add
+// the Follow box as a search engine.
+func handleOpenSearch(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	w.Header().Set("Content-Type", "application/opensearchdescription+xml; charset=utf-8")
+	fmt.Fprintln(w, render("opensearch", map[string]interface{}{
+		"rootURL": rootURL(c),
+	}))
+}
+
+// handleSuggest answers OpenSearch suggestion requests while the user types
+// a Follow query, see suggest.
+func handleSuggest(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	query := r.FormValue("q")
+
+	completions, descriptions, urls := []string{}, []string{}, []string{}
+	if u != nil && query != "" {
+		settings, err := bookmarks.CurrentSettings(c)
+		if err != nil {
+			http.Error(w, err.String(), http.StatusInternalServerError)
+			return
+		}
+		marks, err := bookmarks.ByTags(c, []string{})
+		if err != nil {
+			http.Error(w, err.String(), http.StatusInternalServerError)
+			return
+		}
+		completions, descriptions, urls = suggest(marks, settings, query, rootURL(c))
+	}
+
+	result, err := json.Marshal([]interface{}{query, completions, descriptions, urls})
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-suggestions+json; charset=utf-8")
+	w.Write(result)
+}
+
+// suggest returns the suggestions for a Follow query out of all bookmarks,
+// leaving out the hidden ones like the listing does. Without a space, the
+// last tag of the query is completed (unique tags with the title of their
+// bookmark). Bookmark titles matching the query are suggested along with
+// their click-through URL.
+func suggest(all []bookmarks.Bookmark, settings bookmarks.Settings, query, root string) (completions, descriptions, urls []string) {
+	completions, descriptions, urls = []string{}, []string{}, []string{}
+	add := func(completion, description, url string) {
+		if len(completions) < maxSuggestions {
+			completions = append(completions, completion)
+			descriptions = append(descriptions, description)
+			urls = append(urls, url)
+		}
+	}
+
+	marks := bookmarks.Match(all, settings.HideTags([]string{}))
+	if !strings.Contains(query, " ") {
+		titles := uniqueTagTitles(marks)
+		for _, tag := range bookmarks.CompleteTagList(bookmarks.CountTags(marks), query) {
+			description := pluralize("bookmark", tag.Count, true)
+			if title, ok := titles[tag.Name]; ok {
+				description = title
+			}
+			add(tag.Value, description, "")
+		}
+	}
+
+	lower := strings.ToLower(query)
+	for _, b := range marks {
+		if strings.Contains(strings.ToLower(b.Title), lower) {
+			add(b.Title, b.URL, root+b.GoURL())
+		}
+	}
+	return completions, descriptions, urls
+}
+
+// uniqueTagTitles maps the tags used by exactly one bookmark to its title.
+func uniqueTagTitles(bms []bookmarks.Bookmark) map[string]string {
+	titles := make(map[string]string)
+	seen := make(map[string]bool)
+	for _, b := range bms {
+		for _, tag := range b.Tags {
+			if seen[tag] {
+				titles[tag] = "", false
+			} else {
+				titles[tag] = b.Title
+				seen[tag] = true
+			}
+		}
+	}
+	return titles
+}
@@ -0,0 +1,55 @@
+/*
+	opensearch_test.go - tests for the search suggestions of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"bookmarks"
+	"strings"
+	"testing"
+)
+
+var suggestBookmarks = []bookmarks.Bookmark{
+	{Id: 1, URL: "http://example.org/wiki", Title: "Team wiki", Tags: []string{"wiki"}},
+	{Id: 2, URL: "http://example.org/private", Title: "Private wiki", Tags: []string{"wikipriv", "secret"}},
+	{Id: 3, URL: "http://example.org/old", Title: "Old wiki", Tags: []string{"wikiold", bookmarks.TrashTag}},
+}
+
+func TestSuggestHidden(t *testing.T) {
+	settings := bookmarks.Settings{UserId: testUser, HiddenTags: "secret"}
+	for _, query := range []string{"wiki", "wiki pages"} {
+		completions, descriptions, urls := suggest(suggestBookmarks, settings, query, "http://example.com")
+		all := strings.Join(completions, "|") + "|" + strings.Join(descriptions, "|") + "|" + strings.Join(urls, "|")
+		if strings.Contains(all, "priv") || strings.Contains(all, "old") || strings.Contains(all, "Old") {
+			t.Errorf("suggest(%q) includes hidden bookmarks: %v %v %v", query, completions, descriptions, urls)
+		}
+	}
+
+	completions, _, _ := suggest(suggestBookmarks, settings, "wiki", "http://example.com")
+	if len(completions) != 2 || completions[1] != "Team wiki" {
+		t.Errorf("suggest(%q) = %v, want the tag and the visible bookmark", "wiki", completions)
+	}
+
+	// Without hidden tags, only the trash is left out
+	settings.HiddenTags = ""
+	completions, _, _ = suggest(suggestBookmarks, settings, "Private", "http://example.com")
+	if len(completions) != 1 || completions[0] != "Private wiki" {
+		t.Errorf("suggest without hidden tags = %v, want %q", completions, "Private wiki")
+	}
+}
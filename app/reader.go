@@ -0,0 +1,89 @@
+/*
+	reader.go - distraction-free article view for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"appengine/user"
+	"bookmarks"
+	"http"
+	"strconv"
+)
+
+func init() {
+	http.HandleFunc("/read/", secure(handleRead))
+}
+
+// handleRead shows the article text of the bookmark /read/{id}, which is
+// extracted when the bookmark joins the reading list. Posting the form
+// fetches the page again right away.
+func handleRead(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		redirectToLogin(c, w, r)
+		return
+	}
+
+	id, err := strconv.Atoi64(r.URL.Path[len("/read/"):])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	bm, err := bookmarks.ByID(c, id)
+	if err == bookmarks.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	var article bookmarks.Article
+	if r.Method == "POST" {
+		if !requirePost(c, w, r, u) {
+			return
+		}
+		article, err = bookmarks.FetchArticle(c, bm)
+	} else {
+		article, err = bookmarks.ArticleOf(c, bm)
+	}
+
+	view := map[string]interface{}{
+		"title": bm.Title,
+		"bookmark": bm,
+	}
+	switch {
+	case err == nil && article.Failed():
+		view["notice"] = "The article text couldn't be extracted: " + article.Error
+	case err == nil:
+		view["title"] = article.Title
+		view["article"] = article
+	case err == bookmarks.ErrNotFound:
+		view["notice"] = "The article text hasn't been extracted yet."
+	case err == bookmarks.ErrNotHTML, err == bookmarks.ErrNoArticle, err == bookmarks.ErrCharset:
+		view["notice"] = err.String()
+	default:
+		http.Error(w, err.String(), http.StatusBadGateway)
+		return
+	}
+	output(c, w, "reader", view)
+}
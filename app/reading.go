@@ -0,0 +1,106 @@
+/*
+	reading.go - reading list for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"appengine/user"
+	"bookmarks"
+	"http"
+	"strconv"
+	"url"
+)
+
+func init() {
+	http.HandleFunc("/reading", secure(handleReading))
+	http.HandleFunc("/reading/mark", secure(handleReadingMark))
+}
+
+// handleReading lists the reading list in one state, unread by default.
+func handleReading(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		redirectToLogin(c, w, r)
+		return
+	}
+
+	state := r.FormValue("state")
+	if state == "" {
+		state = bookmarks.StateUnread
+	}
+	settings, err := bookmarks.CurrentSettings(c)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	marks, err := bookmarks.ReadingList(c, settings, state)
+	if err == bookmarks.ErrInvalidState {
+		http.Error(w, err.String(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	output(c, w, "reading", map[string]interface{}{
+		"title": pluralize("bookmark", len(marks), true) + " " + state,
+		"state": state,
+		"bookmarks": marks,
+	})
+}
+
+// handleReadingMark changes the reading state of a bookmark and returns to
+// the reading list.
+func handleReadingMark(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		return
+	}
+	if !requirePost(c, w, r, u) {
+		return
+	}
+
+	id, err := strconv.Atoi64(r.FormValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch err = bookmarks.SetState(c, id, r.FormValue("state")); err {
+	case nil:
+	case bookmarks.ErrNotFound:
+		http.NotFound(w, r)
+		return
+	case bookmarks.ErrInvalidState:
+		http.Error(w, err.String(), http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	back := "/reading"
+	if list := r.FormValue("list"); list != "" {
+		back += "?state=" + url.QueryEscape(list)
+	}
+	http.Redirect(w, r, rootURL(c)+back, http.StatusFound)
+}
@@ -0,0 +1,190 @@
+/*
+	settings.go - settings page for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"appengine/user"
+	"bookmarks"
+	"http"
+	"json"
+	"os"
+	"strings"
+)
+
+func init() {
+	http.HandleFunc("/settings", secure(handleSettings))
+	http.HandleFunc("/api/settings", secure(handleSettingsAPI))
+	http.HandleFunc("/settings/bookmarklet", secure(handleResetBookmarklet))
+}
+
+// settingsFromForm updates the settings from the submitted fields. Fields
+// that are not submitted are left alone. The form sends a hidden "0" before
+// each checkbox, so the last value of a flag counts.
+func settingsFromForm(settings *bookmarks.Settings, r *http.Request) {
+	r.ParseForm()
+	fields := map[string]*string{
+		"hiddenTags": &settings.HiddenTags,
+		"fallbackTag": &settings.FallbackTag,
+		"fallbacks": &settings.Fallbacks,
+		"defaultSort": &settings.DefaultSort,
+		"startQuery": &settings.StartQuery,
+		"dashboard": &settings.Dashboard,
+	}
+	for name, field := range fields {
+		if values, ok := r.Form[name]; ok && len(values) > 0 {
+			*field = values[0]
+		}
+	}
+
+	flags := map[string]*bool{
+		"followRedirect": &settings.FollowRedirect,
+		"noReferrer": &settings.NoReferrer,
+	}
+	for name, flag := range flags {
+		if values, ok := r.Form[name]; ok && len(values) > 0 {
+			value := values[len(values)-1]
+			*flag = value != "" && value != "0" && value != "false"
+		}
+	}
+}
+
+// settingsFromRequest updates the settings from a JSON object with the
+// fields returned by the API, or from form fields otherwise.
+func settingsFromRequest(settings *bookmarks.Settings, r *http.Request) os.Error {
+	ct := r.Header.Get("Content-Type")
+	if strings.HasPrefix(ct, "application/json") {
+		return json.NewDecoder(r.Body).Decode(settings)
+	}
+	settingsFromForm(settings, r)
+	return nil
+}
+
+func handleSettings(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		redirectToLogin(c, w, r)
+		return
+	}
+
+	settings, err := bookmarks.CurrentSettings(c)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	notice := ""
+	if r.Method == "POST" {
+		if !requirePost(c, w, r, u) {
+			return
+		}
+
+		settingsFromForm(&settings, r)
+		if err = settings.Save(c); err != nil {
+			notice = err.String()
+		} else {
+			notice = "Settings saved."
+		}
+	}
+
+	view := map[string]interface{}{
+		"title": "Settings",
+		"settings": settings,
+	}
+	// Empty strings still render mustache sections
+	if notice != "" {
+		view["notice"] = notice
+	}
+	output(c, w, "settings", view)
+}
+
+// handleResetBookmarklet revokes all installed bookmarklets of the user. The
+// bookmarklets on the start page carry the new token afterwards.
+func handleResetBookmarklet(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		http.Error(w, "Not logged in", http.StatusForbidden)
+		return
+	}
+	if !requirePost(c, w, r, u) {
+		return
+	}
+
+	settings, err := bookmarks.CurrentSettings(c)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	settings.TokenGeneration++
+	if err = settings.Save(c); err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// handleSettingsAPI returns the settings as JSON, and the CSRF token in the
+// X-CSRF-Token header. A POST with that token (as header or "csrf" field)
+// and a JSON object or the fields of the settings form changes them first.
+func handleSettingsAPI(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		http.Error(w, "Not logged in", http.StatusForbidden)
+		return
+	}
+
+	settings, err := bookmarks.CurrentSettings(c)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		if !requirePost(c, w, r, u) {
+			return
+		}
+		if err = settingsFromRequest(&settings, r); err != nil {
+			http.Error(w, err.String(), http.StatusBadRequest)
+			return
+		}
+		if err = settings.Save(c); err != nil {
+			http.Error(w, err.String(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	token, err := signToken(c, purposeCSRF, u)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("X-CSRF-Token", token)
+
+	result, err := json.Marshal(settings)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(result)
+}
@@ -0,0 +1,67 @@
+/*
+	settings_test.go - tests for the settings page of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"bookmarks"
+	"http"
+	"strings"
+	"testing"
+	"url"
+)
+
+func TestSettingsFromFormFlags(t *testing.T) {
+	tests := []struct {
+		form url.Values
+		want bool
+	}{
+		// Other fields only, e.g. from the API: the flag is left alone
+		{url.Values{"startQuery": {"work"}}, true},
+		// Unchecked box: only the hidden field
+		{url.Values{"followRedirect": {"0"}}, false},
+		// Checked box: the hidden field, then the checkbox
+		{url.Values{"followRedirect": {"0", "1"}}, true},
+		{url.Values{"followRedirect": {"false"}}, false},
+	}
+	for _, test := range tests {
+		settings := bookmarks.Settings{FollowRedirect: true}
+		settingsFromForm(&settings, newPost(t, "/settings", test.form))
+		if settings.FollowRedirect != test.want {
+			t.Errorf("form %v: FollowRedirect = %v, want %v", test.form, settings.FollowRedirect, test.want)
+		}
+	}
+}
+
+func TestSettingsFromJSON(t *testing.T) {
+	body := `{"startQuery": "work", "followRedirect": false}`
+	r, err := http.NewRequest("POST", "http://example.com/api/settings", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	settings := bookmarks.Settings{UserId: testUser, FollowRedirect: true, HiddenTags: "hidden"}
+	if err := settingsFromRequest(&settings, r); err != nil {
+		t.Fatalf("settingsFromRequest: %v", err)
+	}
+	if settings.StartQuery != "work" || settings.FollowRedirect || settings.HiddenTags != "hidden" || settings.UserId != testUser {
+		t.Errorf("settingsFromRequest = %+v", settings)
+	}
+}
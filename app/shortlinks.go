@@ -0,0 +1,193 @@
+/*
+	shortlinks.go - short link pages for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package app
+
+import (
+	"appengine"
+	"appengine/user"
+	"bookmarks"
+	"http"
+	"os"
+	"strings"
+	"time"
+	"url"
+)
+
+func init() {
+	http.HandleFunc("/s/", secure(handleShortLink))
+	http.HandleFunc("/links", secure(handleLinks))
+	http.HandleFunc("/links/create", secure(handleLinkCreate))
+	http.HandleFunc("/links/delete", secure(handleLinkDelete))
+	http.HandleFunc("/links/stats", secure(handleLinkStats))
+}
+
+// handleShortLink redirects /s/{name}/args... to the target of the short
+// link, filling the remaining path segments into its URL template.
+func handleShortLink(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		redirectToLogin(c, w, r)
+		return
+	}
+
+	segments := strings.Split(r.URL.Path[len("/s/"):], "/")
+	if segments[0] == "" || !followShortLink(c, w, r, segments[0], strings.Join(segments[1:], " ")) {
+		http.NotFound(w, r)
+	}
+}
+
+// followShortLink records a click on the named short link and redirects to
+// it. It reports false without writing a response if the link is unknown.
+func followShortLink(c appengine.Context, w http.ResponseWriter, r *http.Request, name, query string) bool {
+	l, err := bookmarks.ShortLinkByName(c, name)
+	if err == bookmarks.ErrNotFound {
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return true
+	}
+	if l.Expired() {
+		http.Error(w, "This link expired on "+l.ExpiresString(), http.StatusGone)
+		return true
+	}
+
+	referrer := ""
+	if ref, err := url.Parse(r.Referer()); err == nil {
+		referrer = ref.Host
+	}
+	if err := bookmarks.ClickShortLink(c, l.Name, referrer); err != nil {
+		c.Errorf("followShortLink: recording click on %s: %v", l.Name, err)
+	}
+
+	target := bookmarks.FormatURL(l.URL, query, time.Seconds())
+	if !bookmarks.ValidURL(target) {
+		http.Error(w, bookmarks.ErrInvalidScheme.String(), http.StatusBadRequest)
+		return true
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusFound)
+	return true
+}
+
+func handleLinks(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		redirectToLogin(c, w, r)
+		return
+	}
+
+	links, err := bookmarks.ShortLinks(c)
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	output(c, w, "links", map[string]interface{}{
+		"title": pluralize("Short link", len(links), true),
+		"links": links,
+	})
+}
+
+func handleLinkCreate(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		return
+	}
+	if !requirePost(c, w, r, u) {
+		return
+	}
+
+	var expires int64
+	if e := r.FormValue("expires"); e != "" {
+		t, err := time.Parse("2006-01-02", e)
+		if err != nil {
+			http.Error(w, "Invalid expiry date, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		expires = t.Seconds()
+	}
+
+	l := bookmarks.NewShortLink(u, r.FormValue("name"), r.FormValue("url"), expires)
+	if err := l.Create(c); err != nil {
+		linkError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, rootURL(c)+"/links", http.StatusFound)
+}
+
+func handleLinkDelete(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		return
+	}
+	if !requirePost(c, w, r, u) {
+		return
+	}
+
+	if err := bookmarks.DeleteShortLink(c, r.FormValue("name")); err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, rootURL(c)+"/links", http.StatusFound)
+}
+
+func handleLinkStats(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	u := user.Current(c)
+	if u == nil {
+		redirectToLogin(c, w, r)
+		return
+	}
+
+	l, err := bookmarks.ShortLinkByName(c, r.FormValue("name"))
+	if err == bookmarks.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.String(), http.StatusInternalServerError)
+		return
+	}
+
+	output(c, w, "link_stats", map[string]interface{}{
+		"title": "Statistics for /s/" + l.Name,
+		"link": l,
+	})
+}
+
+// linkError reports a failed short link operation, distinguishing invalid
+// input from datastore failures.
+func linkError(w http.ResponseWriter, err os.Error) {
+	switch err {
+	case bookmarks.ErrShortNameTaken:
+		http.Error(w, err.String(), http.StatusConflict)
+	case bookmarks.ErrInvalidShortName, bookmarks.ErrInvalidScheme:
+		http.Error(w, err.String(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.String(), http.StatusInternalServerError)
+	}
+}
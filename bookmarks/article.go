@@ -0,0 +1,430 @@
+/*
+	article.go - article text extraction for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"appengine/delay"
+	"appengine/user"
+	"bytes"
+	"html"
+	"io"
+	"json"
+	"os"
+	"strings"
+	"time"
+)
+
+// Reading speed for the estimated reading time, in words per minute
+const wordsPerMinute = 200
+
+// Maximum number of bytes read from a page
+const maxPageSize = 1 << 20
+
+// How long to wait before extracting the article of a page again after it
+// failed, in seconds: pages without article text don't change quickly, but
+// the host of other pages may just have been down
+const (
+	noArticleRetry = 7 * 24 * 60 * 60
+	articleRetry   = 60 * 60
+)
+
+var ErrNoArticle = os.NewError("No article text found on this page")
+
+// Article is the main text of a bookmarked page, stored under the ID of
+// its bookmark. If extracting it failed, only the error is stored, see
+// Failed.
+type Article struct {
+	UserId string
+	URL string
+	Title string
+	Content []byte // JSON of the []ArticleBlock
+	Words int64
+	TimeFetched int64
+
+	// Why extracting the article failed, and when to try again
+	Error string
+	TimeRetry int64
+}
+
+// ArticleBlock is a paragraph or heading of an article.
+type ArticleBlock struct {
+	Text    string `json:"text"`
+	Heading bool   `json:"heading,omitempty"`
+}
+
+func ArticleKey(c appengine.Context, id int64) *datastore.Key {
+	return datastore.NewKey(c, "Article", "", id, nil)
+}
+
+// Blocks returns the paragraphs and headings of the article.
+func (a Article) Blocks() []ArticleBlock {
+	var blocks []ArticleBlock
+	json.Unmarshal(a.Content, &blocks)
+	return blocks
+}
+
+// Failed reports whether extracting the article failed.
+func (a Article) Failed() bool {
+	return a.Error != ""
+}
+
+// RetryDue reports whether the extraction failed long enough ago to try
+// again.
+func (a Article) RetryDue() bool {
+	return a.Failed() && a.TimeRetry <= time.Seconds()
+}
+
+// Minutes returns the estimated reading time, at least one minute.
+func (a Article) Minutes() int64 {
+	if a.Words < wordsPerMinute {
+		return 1
+	}
+	return (a.Words + wordsPerMinute/2) / wordsPerMinute
+}
+
+// ArticleByID returns the stored article of the current user's bookmark.
+func ArticleByID(c appengine.Context, id int64) (a Article, err os.Error) {
+	err = datastore.Get(c, ArticleKey(c, id), &a)
+	if err == datastore.ErrNoSuchEntity || err == nil && a.UserId != user.Current(c).Id {
+		return Article{}, ErrNotFound
+	}
+	return a, err
+}
+
+// ArticleOf returns the stored article of the current user's bookmark,
+// which may have failed. An article extracted before the bookmark's URL
+// changed doesn't count, so that gives ErrNotFound as well.
+func ArticleOf(c appengine.Context, b Bookmark) (Article, os.Error) {
+	a, err := ArticleByID(c, b.Id)
+	if err == nil && a.URL != b.URL {
+		return Article{}, ErrNotFound
+	}
+	return a, err
+}
+
+// extractArticleLater extracts the article of a bookmark in a task, see
+// extractArticle.
+var extractArticleLater = delay.Func("extractArticle", extractArticle)
+
+// extractArticle stores the article of the bookmark with the given ID,
+// unless it is stored for the bookmark's URL already or failed recently.
+// Like fetchMetadata, it runs without a user.
+func extractArticle(c appengine.Context, id int64) os.Error {
+	var b Bookmark
+	if err := datastore.Get(c, BookmarkKey(c, id), &b); err != nil {
+		c.Infof("extractArticle: bookmark %d: %v", id, err)
+		return nil
+	}
+	b.Id = id
+
+	var a Article
+	if err := datastore.Get(c, ArticleKey(c, id), &a); err == nil && a.URL == b.URL && !a.RetryDue() {
+		return nil
+	}
+	if _, err := FetchArticle(c, b); err != nil {
+		c.Infof("extractArticle: %s: %v", b.URL, err)
+	}
+	return nil
+}
+
+// ExtractLater queues the extraction of the article of the bookmark with
+// the given ID, see extractArticle.
+func ExtractLater(c appengine.Context, id int64) {
+	extractArticleLater.Call(c, id)
+}
+
+// FetchArticle downloads the page of the bookmark, extracts its article
+// text and stores it. A failure is stored instead, unless there is an
+// article of this URL already.
+func FetchArticle(c appengine.Context, b Bookmark) (a Article, err os.Error) {
+	key := ArticleKey(c, b.Id)
+	if a, err = fetchArticle(c, b); err != nil {
+		var old Article
+		if datastore.Get(c, key, &old) == nil && old.URL == b.URL && !old.Failed() {
+			return a, err
+		}
+		failed := failedArticle(b, err, time.Seconds())
+		if _, perr := datastore.Put(c, key, &failed); perr != nil {
+			c.Errorf("FetchArticle: storing failure of %s: %v", b.URL, perr)
+		}
+		return a, err
+	}
+	_, err = datastore.Put(c, key, &a)
+	return a, err
+}
+
+func fetchArticle(c appengine.Context, b Bookmark) (Article, os.Error) {
+	if s := URLScheme(b.URL); s != "http" && s != "https" {
+		return Article{}, ErrNotHTML
+	}
+	page, err := fetchPage(fetchClient(c), b.URL, maxPageSize)
+	if err != nil {
+		return Article{}, err
+	}
+	return ParseArticle(bytes.NewBuffer(page), b)
+}
+
+// failedArticle records that extracting the article of the bookmark failed
+// at the given time.
+func failedArticle(b Bookmark, err os.Error, now int64) Article {
+	retry := int64(articleRetry)
+	switch err {
+	case ErrNotHTML, ErrNoArticle, ErrCharset:
+		retry = noArticleRetry
+	}
+	return Article{UserId: b.UserId, URL: b.URL, Title: b.Title, Error: err.String(), TimeFetched: now, TimeRetry: now + retry}
+}
+
+// ParseArticle extracts the article of the bookmark from its page, see
+// ExtractArticle. Pages without article text give ErrNoArticle.
+func ParseArticle(r io.Reader, b Bookmark) (a Article, err os.Error) {
+	title, blocks := ExtractArticle(r)
+	if len(blocks) == 0 {
+		return a, ErrNoArticle
+	}
+	if title == "" {
+		title = b.Title
+	}
+
+	a = Article{UserId: b.UserId, URL: b.URL, Title: title, TimeFetched: time.Seconds()}
+	for _, block := range blocks {
+		a.Words += int64(len(strings.Fields(block.Text)))
+	}
+	a.Content, err = json.Marshal(blocks)
+	return a, err
+}
+
+/*
+	ExtractArticle finds the main text of a page the way readability does:
+	every paragraph scores points for the element containing it (and half
+	of them for the element around that), depending on its length and
+	number of commas. Class names and IDs like "comment" or "sidebar" cost
+	points, ones like "article" or "content" earn some. The paragraphs
+	inside the best scored element make up the article.
+*/
+
+// Elements whose text is never part of an article
+var skippedTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "nav": true,
+	"header": true, "footer": true, "aside": true, "form": true,
+	"iframe": true, "object": true, "svg": true, "button": true,
+	"select": true, "textarea": true,
+}
+
+// Elements that are never closed
+var voidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "wbr": true,
+}
+
+// Elements holding a paragraph of text, and the headings among them
+var textTags = map[string]bool{
+	"p": true, "pre": true, "blockquote": true, "li": true, "dd": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// Elements that may contain the article
+var containerTags = map[string]bool{
+	"body": true, "div": true, "article": true, "section": true,
+	"main": true, "td": true,
+}
+
+var unlikelyNames = []string{"comment", "footer", "sidebar", "nav", "menu", "share", "social", "promo", "sponsor", "related", "banner", "advert"}
+var likelyNames = []string{"article", "content", "entry", "main", "post", "story", "text"}
+
+// Minimum length of a paragraph that isn't a heading
+const minParagraph = 25
+
+type extractNode struct {
+	name   string
+	parent int
+	weight float64
+	score  float64
+}
+
+type extractBlock struct {
+	ArticleBlock
+	node int
+}
+
+// ExtractArticle returns the title and the main text of an HTML page.
+func ExtractArticle(r io.Reader) (title string, blocks []ArticleBlock) {
+	nodes := []extractNode{{name: "#root", parent: -1}}
+	stack := []int{0}
+	var found []extractBlock
+	var text []string
+	textTag, inTitle, skip := "", false, 0
+
+	// container returns the innermost open container element
+	container := func() int {
+		for i := len(stack) - 1; i > 0; i-- {
+			if containerTags[nodes[stack[i]].name] {
+				return stack[i]
+			}
+		}
+		return 0
+	}
+
+	flush := func() {
+		t := strings.Join(strings.Fields(strings.Join(text, " ")), " ")
+		heading := len(textTag) == 2 && textTag[0] == 'h'
+		text = text[:0]
+		if t == "" || !heading && len(t) < minParagraph {
+			return
+		}
+		n := container()
+		found = append(found, extractBlock{ArticleBlock{t, heading}, n})
+		if heading {
+			return
+		}
+
+		score := 1 + float64(strings.Count(t, ","))
+		if l := float64(len(t)) / 100; l < 3 {
+			score += l
+		} else {
+			score += 3
+		}
+		nodes[n].score += score
+		if p := nodes[n].parent; p >= 0 {
+			nodes[p].score += score / 2
+		}
+	}
+
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			if tag == "title" {
+				inTitle = true
+			}
+			if voidTags[tag] || tt == html.SelfClosingTagToken {
+				continue
+			}
+
+			if skip > 0 || skippedTags[tag] {
+				skip++
+				stack = append(stack, len(nodes))
+				nodes = append(nodes, extractNode{name: tag, parent: container()})
+				continue
+			}
+			if textTags[tag] || containerTags[tag] {
+				flush()
+			}
+			if textTags[tag] {
+				textTag = tag
+			}
+
+			node := extractNode{name: tag, parent: container()}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if k := string(key); k == "class" || k == "id" {
+					node.weight += nameWeight(strings.ToLower(string(val)))
+				}
+			}
+			if tag == "article" {
+				node.weight += 25
+			}
+			stack = append(stack, len(nodes))
+			nodes = append(nodes, node)
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if tag == "title" {
+				inTitle = false
+			}
+
+			// Close the element, and everything left open inside it
+			for i := len(stack) - 1; i > 0; i-- {
+				if nodes[stack[i]].name != tag {
+					continue
+				}
+				for j := len(stack) - 1; j >= i; j-- {
+					if open := stack[j]; skip > 0 {
+						skip--
+					} else if name := nodes[open].name; textTags[name] || containerTags[name] {
+						flush()
+						textTag = ""
+					}
+				}
+				stack = stack[:i]
+				break
+			}
+
+		case html.TextToken:
+			if inTitle {
+				title += string(z.Text())
+			} else if skip == 0 {
+				text = append(text, string(z.Text()))
+			}
+		}
+	}
+	flush()
+
+	// The best scored element, favoring those named like an article
+	best, bestScore := -1, 0.0
+	for i, n := range nodes {
+		if n.score > 0 && (best < 0 || n.score+n.weight > bestScore) {
+			best, bestScore = i, n.score+n.weight
+		}
+	}
+	if best < 0 {
+		return strings.TrimSpace(title), nil
+	}
+
+	for _, b := range found {
+		for n := b.node; n >= 0; n = nodes[n].parent {
+			if n == best {
+				blocks = append(blocks, b.ArticleBlock)
+				break
+			}
+		}
+	}
+	return strings.Join(strings.Fields(title), " "), blocks
+}
+
+// nameWeight rates a class name or ID.
+func nameWeight(name string) float64 {
+	weight := 0.0
+	for _, s := range unlikelyNames {
+		if strings.Contains(name, s) {
+			weight -= 25
+			break
+		}
+	}
+	for _, s := range likelyNames {
+		if strings.Contains(name, s) {
+			weight += 25
+			break
+		}
+	}
+	return weight
+}
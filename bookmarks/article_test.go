@@ -0,0 +1,158 @@
+/*
+	article_test.go - tests for the reader view of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"bytes"
+	"http"
+	"http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fetchTestArticle serves the testdata directory and extracts the article
+// of the named page, like FetchArticle does.
+func fetchTestArticle(name string) (Article, os.Error) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	b := Bookmark{UserId: "12345", URL: server.URL + "/" + name, Title: "Bookmark title"}
+	page, err := fetchPage(http.DefaultClient, b.URL, maxPageSize)
+	if err != nil {
+		return Article{}, err
+	}
+	return ParseArticle(bytes.NewBuffer(page), b)
+}
+
+func TestExtractArticle(t *testing.T) {
+	a, err := fetchTestArticle("article.html")
+	if err != nil {
+		t.Fatalf("article.html: %v", err)
+	}
+	if a.Title != "Gardening in Winter" {
+		t.Errorf("Title = %q, want %q", a.Title, "Gardening in Winter")
+	}
+
+	blocks := a.Blocks()
+	want := []ArticleBlock{
+		{"Preparing the beds", true},
+		{"Cover the beds with a thick layer of leaves, so the soil stays warm and moist.", false},
+		{"Cut back the perennials, but leave the seed heads for the birds, they will thank you.", false},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("Blocks = %v, want %v", blocks, want)
+	}
+	for i, block := range blocks {
+		if block.Text != want[i].Text || block.Heading != want[i].Heading {
+			t.Errorf("block %d = %v, want %v", i+1, block, want[i])
+		}
+	}
+
+	// Navigation, header, sidebar, footer and scripts are left out
+	for _, text := range []string{"My Blog", "Home page", "Subscribe", "Copyright", "Scripts"} {
+		for _, block := range blocks {
+			if strings.Contains(block.Text, text) {
+				t.Errorf("block %q contains %q", block.Text, text)
+			}
+		}
+	}
+
+	if a.Words != 35 {
+		t.Errorf("Words = %d, want 35", a.Words)
+	}
+	if a.Minutes() != 1 {
+		t.Errorf("Minutes = %d, want 1", a.Minutes())
+	}
+}
+
+func TestExtractArticleUntitled(t *testing.T) {
+	a, err := fetchTestArticle("untitled.html")
+	if err != nil {
+		t.Fatalf("untitled.html: %v", err)
+	}
+	if a.Title != "Bookmark title" {
+		t.Errorf("Title = %q, want the bookmark title", a.Title)
+	}
+	if len(a.Blocks()) != 1 {
+		t.Errorf("Blocks = %v, want one paragraph", a.Blocks())
+	}
+}
+
+func TestExtractArticleErrors(t *testing.T) {
+	if _, err := fetchTestArticle("navigation.html"); err != ErrNoArticle {
+		t.Errorf("navigation.html: got error %v, want %v", err, ErrNoArticle)
+	}
+	if _, err := fetchTestArticle("notes.txt"); err != ErrNotHTML {
+		t.Errorf("notes.txt: got error %v, want %v", err, ErrNotHTML)
+	}
+	if _, err := fetchTestArticle("missing.html"); err == nil {
+		t.Errorf("missing.html: fetched a page that doesn't exist")
+	}
+}
+
+func TestMinutes(t *testing.T) {
+	tests := []struct {
+		words   int64
+		minutes int64
+	}{
+		{0, 1},
+		{199, 1},
+		{299, 1},
+		{300, 2},
+		{1000, 5},
+	}
+	for _, test := range tests {
+		if got := (Article{Words: test.words}).Minutes(); got != test.minutes {
+			t.Errorf("Minutes for %d words = %d, want %d", test.words, got, test.minutes)
+		}
+	}
+}
+
+func TestFailedArticle(t *testing.T) {
+	now := time.Seconds()
+	b := Bookmark{UserId: "12345", URL: "http://example.org/", Title: "Example"}
+	tests := []struct {
+		err   os.Error
+		retry int64
+	}{
+		{ErrNoArticle, noArticleRetry},
+		{ErrNotHTML, noArticleRetry},
+		{os.NewError("connection refused"), articleRetry},
+	}
+	for _, test := range tests {
+		a := failedArticle(b, test.err, now)
+		if !a.Failed() || a.Error != test.err.String() || a.URL != b.URL || a.UserId != b.UserId {
+			t.Errorf("failedArticle(%v) = %v", test.err, a)
+		}
+		if a.TimeRetry != now+test.retry || a.RetryDue() {
+			t.Errorf("failedArticle(%v) retries at %d, want %d", test.err, a.TimeRetry, now+test.retry)
+		}
+	}
+
+	a := failedArticle(b, ErrNoArticle, now-noArticleRetry)
+	if !a.RetryDue() {
+		t.Errorf("RetryDue = false after the retry time")
+	}
+	if (Article{URL: b.URL}).RetryDue() {
+		t.Errorf("RetryDue = true for an extracted article")
+	}
+}
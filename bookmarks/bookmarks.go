@@ -24,16 +24,62 @@ import (
 	"appengine/datastore"
 	"appengine/user"
 	"os"
+	"strconv"
 	"strings"
 	"url"
 )
 
+// AllowedSchemes lists the URL schemes a bookmark may point to. Everything
+// else, most importantly "javascript:" and "data:", is refused on save and
+// never rendered as a link or followed. The app replaces these defaults with
+// the list configured in its schemes.txt, see ParseSchemes.
+var AllowedSchemes = []string{"http", "https", "ftp", "mailto"}
+
+// unsafeSchemes run code in the page that opens them and are never allowed.
+var unsafeSchemes = []string{"javascript", "vbscript", "data"}
+
+var ErrInvalidScheme = os.NewError("URL scheme is not allowed")
+var ErrInvalidMethod = os.NewError("Method must be GET or POST")
+var ErrNotFound = os.NewError("Bookmark not found")
+var ErrURLExists = os.NewError("Another bookmark already has this URL")
+
+// Request methods for following a bookmark. POST bookmarks send their Body
+// as a form, see FormFields.
+const (
+	MethodGet  = "GET"
+	MethodPost = "POST"
+)
+
 type Bookmark struct {
+	Id int64 `datastore:"-"`
+	// Search query to fill into the URL, see TargetURL
+	Query string `datastore:"-"`
 	UserId string
 	URL string
 	Title string
 	Tags []string
 	TimeUpdated int64
+	TimeAdded int64
+
+	// Reading list state, see StateUnread
+	ReadState string
+
+	// Page metadata, see fetchMetadata. AutoTitle is set while the title
+	// wasn't given by the user and may be replaced by the page's.
+	AutoTitle bool
+	Description string
+	CanonicalURL string
+	ImageURL string
+	TimeFetched int64
+
+	// Request method and form body template (for POST only)
+	Method string
+	Body string
+
+	// Click-through statistics, see Visit and Frecency
+	Visits int64
+	TimeVisited int64
+	Score float64
 }
 
 type Tag struct {
@@ -42,23 +88,69 @@ type Tag struct {
 }
 
 func NewBookmark(u *user.User, url, title string, tags []string) Bookmark {
-	return Bookmark{u.Id, url, title, tags, 0}
+	return Bookmark{UserId: u.Id, URL: url, Title: title, Tags: tags}
 }
 
+func BookmarkKey(c appengine.Context, id int64) *datastore.Key {
+	return datastore.NewKey(c, "Bookmark", "", id, nil)
+}
 
-func (b Bookmark) FaviconURL() string {
-	domain := ""
+// ByID returns the bookmark with the given ID, if it belongs to the current
+// user.
+func ByID(c appengine.Context, id int64) (b Bookmark, err os.Error) {
+	err = datastore.Get(c, BookmarkKey(c, id), &b)
+	if err == datastore.ErrNoSuchEntity || err == nil && b.UserId != user.Current(c).Id {
+		return Bookmark{}, ErrNotFound
+	}
+	b.Id = id
+	return b, err
+}
+
+
+// Domain returns the lowercased host (and port) of the bookmark's URL, or
+// "" if it has none.
+func (b Bookmark) Domain() string {
 	u, err := url.Parse(b.URL)
-	if err == nil {
-		domain = u.Host
+	if err != nil || !ValidDomain(strings.ToLower(u.Host)) {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// FaviconURL returns the link to the icon of the bookmark's domain, served
+// from our own cache. The bookmark's ID lets the handler queue a fetch of
+// missing icons, see RefreshFavicon. Bookmarks without a domain get the
+// generic placeholder, which the empty domain never looks up.
+func (b Bookmark) FaviconURL() string {
+	domain := b.Domain()
+	if domain == "" {
+		return "/favicon/"
+	}
+	if b.Id == 0 {
+		return "/favicon/" + domain
+	}
+	return "/favicon/" + domain + "?id=" + strconv.Itoa64(b.Id)
+}
+
+// SafeURL returns the URL for use in links, or "#" if its scheme is not
+// allowed (e.g. for bookmarks stored before schemes were checked).
+func (b Bookmark) SafeURL() string {
+	if !ValidURL(b.URL) {
+		return "#"
 	}
-	return "http://www.google.com/s2/u/0/favicons?domain=" + domain
+	return b.URL
 }
 
 func (b Bookmark) EscapedURL() string {
 	return url.QueryEscape(b.URL)
 }
 
+// Stored reports whether the bookmark is saved in the datastore, as opposed
+// to e.g. a search engine suggested by a fallback.
+func (b Bookmark) Stored() bool {
+	return b.Id != 0
+}
+
 func (b Bookmark) TagString() string {
 	return strings.Join(b.Tags, ",")
 }
@@ -67,9 +159,8 @@ func (b *Bookmark) Save(c appengine.Context) (success bool, err os.Error) {
 	if b.URL == "" {
 		return false, nil
 	}
-
-	if b.Title == "" {
-		b.Title = b.URL
+	if err = b.validate(); err != nil {
+		return false, err
 	}
 
 	key, err := Exists(c, *b)
@@ -80,27 +171,122 @@ func (b *Bookmark) Save(c appengine.Context) (success bool, err os.Error) {
 	if key == nil {
 		key = datastore.NewIncompleteKey(c, "Bookmark", nil)
 	}
+	err = b.put(c, key)
+	return err != nil, err
+}
+
+// Update stores the bookmark under its ID, which allows changing its URL.
+// It fails with ErrURLExists if another bookmark already has the new URL.
+func (b *Bookmark) Update(c appengine.Context) os.Error {
+	if _, err := ByID(c, b.Id); err != nil {
+		return err
+	}
+	if err := b.validate(); err != nil {
+		return err
+	}
+
+	key, err := Exists(c, *b)
+	if err != nil {
+		return err
+	}
+	if key != nil && key.IntID() != b.Id {
+		return ErrURLExists
+	}
+	return b.put(c, BookmarkKey(c, b.Id))
+}
+
+// validate checks and normalizes the user-supplied fields.
+func (b *Bookmark) validate() os.Error {
+	if !ValidURL(b.URL) {
+		return ErrInvalidScheme
+	}
+	if !ValidState(b.ReadState) {
+		return ErrInvalidState
+	}
+
+	switch b.Method = strings.ToUpper(b.Method); b.Method {
+	case "", MethodGet:
+		b.Method, b.Body = "", ""
+	case MethodPost:
+	default:
+		return ErrInvalidMethod
+	}
+
+	b.AutoTitle = b.Title == "" || b.Title == b.URL
+	if b.Title == "" {
+		b.Title = b.URL
+	}
+	return nil
+}
+
+// put stores the bookmark under key, keeping the statistics of the bookmark
+// it replaces (and its metadata while the URL stays the same). Metadata of
+// new URLs is fetched in the background.
+func (b *Bookmark) put(c appengine.Context, key *datastore.Key) (err os.Error) {
+	fetchLater, extractLater := true, true
+	if !key.Incomplete() {
+		var old Bookmark
+		if err = datastore.Get(c, key, &old); err != nil {
+			return err
+		}
+		b.Visits, b.TimeVisited, b.Score = old.Visits, old.TimeVisited, old.Score
+		b.TimeAdded = old.TimeAdded
+		if b.ReadState == "" {
+			b.ReadState = old.ReadState
+		}
+		if b.URL == old.URL {
+			b.Description, b.CanonicalURL, b.ImageURL = old.Description, old.CanonicalURL, old.ImageURL
+			b.TimeFetched = old.TimeFetched
+			if b.Title == old.Title {
+				b.AutoTitle = old.AutoTitle
+			}
+			fetchLater = old.TimeFetched == 0
+			extractLater = old.ReadState != StateUnread
+		}
+	}
 	b.TimeUpdated, _, err = os.Time()
 	if err != nil {
-		return false, err
+		return err
+	}
+	if b.TimeAdded == 0 && key.Incomplete() {
+		b.TimeAdded = b.TimeUpdated
 	}
 
 	// "!tag" makes this tag unique: the tag will be removed from all other
 	// bookmarks in the datastore
-	for i, tag := range(b.Tags) {
-		if tag == "" {
-			continue;
+	for _, tag := range uniqueTags(b.Tags) {
+		DeleteTag(c, tag)
+	}
+
+	key, err = datastore.Put(c, key, b)
+	if err != nil {
+		return err
+	}
+	b.Id = key.IntID()
+
+	if s := URLScheme(b.URL); s == "http" || s == "https" {
+		if fetchLater {
+			fetchMetadataLater.Call(c, b.Id)
 		}
-		op := tag[0:1]
-		if op == "!" {
-			tag = tag[1:]
-			b.Tags[i] = tag
-			DeleteTag(c, tag)
+		// Articles are extracted when they join the reading list
+		if extractLater && b.Unread() {
+			extractArticleLater.Call(c, b.Id)
 		}
 	}
+	return nil
+}
 
-	_, err = datastore.Put(c, key, b)
-	return err != nil, err
+// uniqueTags strips the "!" (unique) prefix from the tags in place and
+// returns the tags that had it.
+func uniqueTags(tags []string) []string {
+	var unique []string
+	for i, tag := range tags {
+		if len(tag) > 1 && tag[0] == '!' {
+			tags[i] = tag[1:]
+			unique = append(unique, tags[i])
+		}
+	}
+	return unique
 }
 
 func (b *Bookmark) Delete(c appengine.Context) (success bool, err os.Error) {
@@ -113,7 +299,7 @@ func (b *Bookmark) Delete(c appengine.Context) (success bool, err os.Error) {
 		return false, err
 	}
 
-	err = datastore.Delete(c, key)
+	err = datastore.DeleteMulti(c, []*datastore.Key{key, ArticleKey(c, key.IntID())})
 	return err != nil, err
 }
 
@@ -154,6 +340,10 @@ func ByTags(c appengine.Context, tags []string) (bms []Bookmark, err os.Error) {
 	// Build query
 	var negTags []string
 	for _, tag := range(tags) {
+		if strings.HasPrefix(tag, StatePrefix) {
+			q.Filter("ReadState=", tag[len(StatePrefix):])
+			continue
+		}
 		if tag != "" {
 			op := tag[0:1]
 			switch op {
@@ -169,7 +359,10 @@ func ByTags(c appengine.Context, tags []string) (bms []Bookmark, err os.Error) {
 		return
 	}
 	bms = make([]Bookmark, 0, count)
-	_, err = q.GetAll(c, &bms)
+	keys, err := q.GetAll(c, &bms)
+	for i, key := range keys {
+		bms[i].Id = key.IntID()
+	}
 
 	bms = FilterTags(bms, negTags)
 
@@ -188,6 +381,62 @@ func Exists(c appengine.Context, b Bookmark) (key *datastore.Key, err os.Error)
 	return nil, nil
 }
 
+// URLScheme returns the lowercased scheme of a raw URL, or "" if it has none.
+// It doesn't use url.Parse, as search templates like "%s" are not valid
+// escapes.
+func URLScheme(raw string) string {
+	for i := 0; i < len(raw); i++ {
+		ch := raw[i]
+		switch {
+		case 'a' <= ch && ch <= 'z', 'A' <= ch && ch <= 'Z':
+		case '0' <= ch && ch <= '9', ch == '+', ch == '-', ch == '.':
+			if i == 0 {
+				return ""
+			}
+		case ch == ':':
+			return strings.ToLower(raw[:i])
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// ParseSchemes parses a list of allowed URL schemes, one per line. Empty
+// lines and lines starting with "#" are ignored.
+func ParseSchemes(text string) ([]string, os.Error) {
+	var schemes []string
+	for _, line := range strings.Split(text, "\n") {
+		scheme := strings.ToLower(strings.TrimSpace(line))
+		if scheme == "" || scheme[0] == '#' {
+			continue
+		}
+		if URLScheme(scheme+":") != scheme {
+			return nil, os.NewError("Invalid URL scheme '" + scheme + "'")
+		}
+		for _, s := range unsafeSchemes {
+			if scheme == s {
+				return nil, os.NewError("URL scheme '" + scheme + "' can't be allowed")
+			}
+		}
+		schemes = append(schemes, scheme)
+	}
+	if len(schemes) == 0 {
+		return nil, os.NewError("No URL schemes allowed")
+	}
+	return schemes, nil
+}
+
+func ValidURL(raw string) bool {
+	scheme := URLScheme(raw)
+	for _, s := range AllowedSchemes {
+		if scheme == s {
+			return true
+		}
+	}
+	return false
+}
+
 func FilterTags(bms []Bookmark, tags []string) []Bookmark {
 	if len(tags) == 0 {
 		return bms
@@ -0,0 +1,63 @@
+/*
+	bookmarks_test.go - tests for the bookmark storage of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"testing"
+)
+
+func TestSaveRefusesSchemes(t *testing.T) {
+	for _, raw := range []string{
+		"javascript:alert(1)",
+		"JavaScript:alert(1)",
+		" javascript:alert(1)",
+		"data:text/html,<script>alert(1)</script>",
+		"vbscript:msgbox(1)",
+		"example.org",
+	} {
+		// Invalid URLs are refused before the datastore is used
+		b := Bookmark{URL: raw}
+		if ok, err := b.Save(nil); ok || err != ErrInvalidScheme {
+			t.Errorf("Save(%q) = %v, %v, want false, ErrInvalidScheme", raw, ok, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, raw := range []string{"http://example.org/", "HTTPS://example.org/", "mailto:me@example.org"} {
+		b := Bookmark{URL: raw}
+		if err := b.validate(); err != nil {
+			t.Errorf("validate(%q) = %v, want nil", raw, err)
+		}
+	}
+}
+
+func TestParseSchemes(t *testing.T) {
+	schemes, err := ParseSchemes("# comment\nhttp\n\n HTTPS \ngopher\n")
+	if err != nil || len(schemes) != 3 || schemes[1] != "https" || schemes[2] != "gopher" {
+		t.Errorf("ParseSchemes = %v, %v", schemes, err)
+	}
+
+	for _, text := range []string{"http\njavascript", "Data", "http:", "no scheme", "# only comments\n"} {
+		if schemes, err := ParseSchemes(text); err == nil {
+			t.Errorf("ParseSchemes(%q) = %v, want an error", text, schemes)
+		}
+	}
+}
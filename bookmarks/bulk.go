@@ -0,0 +1,450 @@
+/*
+	bulk.go - bulk operations for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+	"json"
+	"os"
+	"strings"
+)
+
+// Bulk operations
+const (
+	BulkAddTags    = "add"
+	BulkRemoveTags = "remove"
+	BulkReplaceTag = "replace"
+	BulkDelete     = "delete"
+	BulkTrash      = "trash"
+)
+
+// Bookmarks moved to the trash get this tag, which hides them from listings.
+const TrashTag = "trash"
+
+// Number of entities written per PutMulti/DeleteMulti call
+const bulkBatchSize = 100
+
+// Bulk operations change at most MaxBulkSize bookmarks at once, which keeps
+// the tag changes stored for undo well below the datastore's entity size
+// limit. Deleted bookmarks are stored completely, up to maxUndoSize bytes.
+// Their articles stay in the datastore until the next bulk operation
+// replaces the undo state.
+const (
+	MaxBulkSize = 1000
+	maxUndoSize = 900 * 1024
+)
+
+var ErrInvalidBulkOp = os.NewError("Unknown bulk operation or missing tags")
+var ErrTooManyBookmarks = os.NewError("Too many bookmarks for a bulk operation, narrow down your query")
+var ErrNothingToUndo = os.NewError("Nothing to undo")
+
+// BulkOp describes a change applied to many bookmarks at once. Tags are the
+// tags to add or remove; ReplaceTag renames From to To.
+type BulkOp struct {
+	Op   string
+	Tags []string
+	From string
+	To   string
+}
+
+// tagChange records the tags a bulk operation added to and removed from one
+// bookmark, as comma-separated lists.
+type tagChange struct {
+	Id      int64
+	Added   string
+	Removed string
+}
+
+// UndoState stores what the last bulk operation changed: the tag changes of
+// each bookmark (including the unique tags removed from other bookmarks), or
+// the deleted bookmarks.
+type UndoState struct {
+	Op   string
+	Data []byte
+}
+
+func undoKey(c appengine.Context) *datastore.Key {
+	return datastore.NewKey(c, "UndoState", user.Current(c).Id, 0, nil)
+}
+
+func (op BulkOp) valid() bool {
+	switch op.Op {
+	case BulkAddTags, BulkRemoveTags:
+		return len(op.Tags) > 0
+	case BulkReplaceTag:
+		return op.From != "" && op.To != ""
+	case BulkDelete, BulkTrash:
+		return true
+	}
+	return false
+}
+
+// normalize strips the "!" (unique) prefix from the tags the operation adds,
+// like Save does, and returns those tags.
+func (op *BulkOp) normalize() []string {
+	switch op.Op {
+	case BulkAddTags:
+		op.Tags = append([]string(nil), op.Tags...)
+		return uniqueTags(op.Tags)
+	case BulkReplaceTag:
+		to := []string{op.To}
+		unique := uniqueTags(to)
+		op.To = to[0]
+		return unique
+	}
+	return nil
+}
+
+// Affected returns the bookmarks the operation would change.
+func (op BulkOp) Affected(bms []Bookmark) []Bookmark {
+	op.normalize()
+
+	var affected []Bookmark
+	for _, b := range bms {
+		changed := true
+		if op.Op != BulkDelete {
+			added, removed := diffTags(b.Tags, op.apply(b.Tags))
+			changed = len(added) > 0 || len(removed) > 0
+		}
+		if changed {
+			affected = append(affected, b)
+		}
+	}
+	return affected
+}
+
+// apply returns the tags after the operation. It doesn't modify tags.
+func (op BulkOp) apply(tags []string) []string {
+	tags = append([]string(nil), tags...)
+	switch op.Op {
+	case BulkAddTags:
+		tags = addTags(tags, op.Tags)
+	case BulkRemoveTags:
+		tags = removeTags(tags, op.Tags)
+	case BulkReplaceTag:
+		if has, _ := ContainsTag(tags, op.From); has {
+			tags = addTags(removeTags(tags, []string{op.From}), []string{op.To})
+		}
+	case BulkTrash:
+		tags = addTags(tags, []string{TrashTag})
+	}
+	return tags
+}
+
+func addTags(tags, add []string) []string {
+	for _, tag := range add {
+		if has, _ := ContainsTag(tags, tag); !has && tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func removeTags(tags, remove []string) []string {
+	var kept []string
+	for _, tag := range tags {
+		if has, _ := ContainsTag(remove, tag); !has {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
+
+// diffTags returns the tags in after but not in before, and the other way
+// round.
+func diffTags(before, after []string) (added, removed []string) {
+	for _, tag := range after {
+		if has, _ := ContainsTag(before, tag); !has {
+			added = append(added, tag)
+		}
+	}
+	for _, tag := range before {
+		if has, _ := ContainsTag(after, tag); !has {
+			removed = append(removed, tag)
+		}
+	}
+	return added, removed
+}
+
+// untagChanges returns the tag changes of removing each unique tag from the
+// bookmarks with the IDs in tagged, except for the affected bookmarks, whose
+// changes are recorded already. Each bookmark gets a single change.
+func untagChanges(unique []string, tagged [][]int64, affected []Bookmark) []tagChange {
+	skip := make(map[int64]bool, len(affected))
+	for _, b := range affected {
+		skip[b.Id] = true
+	}
+
+	var changes []tagChange
+	index := make(map[int64]int)
+	for i, tag := range unique {
+		for _, id := range tagged[i] {
+			if skip[id] {
+				continue
+			}
+			if j, ok := index[id]; ok {
+				changes[j].Removed += "," + tag
+				continue
+			}
+			index[id] = len(changes)
+			changes = append(changes, tagChange{Id: id, Removed: tag})
+		}
+	}
+	return changes
+}
+
+// taggedIds returns the IDs of the current user's bookmarks with the tag.
+func taggedIds(c appengine.Context, tag string) ([]int64, os.Error) {
+	q := datastore.NewQuery("Bookmark").Filter("UserId=", user.Current(c).Id).Filter("Tags=", tag).KeysOnly()
+	keys, err := q.GetAll(c, nil)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(keys))
+	for i, key := range keys {
+		ids[i] = key.IntID()
+	}
+	return ids, nil
+}
+
+// ParseTags splits a comma-separated tag list, dropping empty tags.
+func ParseTags(tagString string) []string {
+	var tags []string
+	for _, tag := range strings.Split(tagString, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// batches calls f with consecutive index ranges of at most bulkBatchSize
+// out of n elements. It stops at the first error and returns the number of
+// elements handled before.
+func batches(n int, f func(start, end int) os.Error) (int, os.Error) {
+	for start := 0; start < n; start += bulkBatchSize {
+		end := start + bulkBatchSize
+		if end > n {
+			end = n
+		}
+		if err := f(start, end); err != nil {
+			return start, err
+		}
+	}
+	return n, nil
+}
+
+// Bulk applies the operation to the affected bookmarks in batches and
+// returns their number. What it changed is kept for Undo.
+func Bulk(c appengine.Context, bms []Bookmark, op BulkOp) (int, os.Error) {
+	if !op.valid() {
+		return 0, ErrInvalidBulkOp
+	}
+	unique := op.normalize()
+	bms = op.Affected(bms)
+	if len(bms) == 0 {
+		return 0, nil
+	}
+	if len(bms) > MaxBulkSize {
+		return 0, ErrTooManyBookmarks
+	}
+
+	if op.Op == BulkDelete {
+		data, err := json.Marshal(bms)
+		if err != nil {
+			return 0, err
+		}
+		if err = putUndo(c, UndoState{op.Op, data}); err != nil {
+			return 0, err
+		}
+		return batches(len(bms), func(start, end int) os.Error {
+			keys := make([]*datastore.Key, 0, end-start)
+			for _, b := range bms[start:end] {
+				keys = append(keys, BookmarkKey(c, b.Id))
+			}
+			return datastore.DeleteMulti(c, keys)
+		})
+	}
+
+	now, _, err := os.Time()
+	if err != nil {
+		return 0, err
+	}
+	changes := make([]tagChange, len(bms))
+	for i := range bms {
+		b := &bms[i]
+		tags := op.apply(b.Tags)
+		added, removed := diffTags(b.Tags, tags)
+		changes[i] = tagChange{b.Id, strings.Join(added, ","), strings.Join(removed, ",")}
+		b.Tags, b.TimeUpdated = tags, now
+	}
+
+	// Unique tags are removed from other bookmarks, which undo restores too
+	tagged := make([][]int64, len(unique))
+	for i, tag := range unique {
+		if tagged[i], err = taggedIds(c, tag); err != nil {
+			return 0, err
+		}
+	}
+	changes = append(changes, untagChanges(unique, tagged, bms)...)
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return 0, err
+	}
+	if err = putUndo(c, UndoState{op.Op, data}); err != nil {
+		return 0, err
+	}
+
+	// Like Save, remove unique tags from all other bookmarks first
+	for _, tag := range unique {
+		if err = DeleteTag(c, tag); err != nil {
+			return 0, err
+		}
+	}
+	return batches(len(bms), func(start, end int) os.Error {
+		keys := make([]*datastore.Key, 0, end-start)
+		refs := make([]interface{}, 0, end-start)
+		for i := start; i < end; i++ {
+			keys = append(keys, BookmarkKey(c, bms[i].Id))
+			refs = append(refs, &bms[i])
+		}
+		_, err := datastore.PutMulti(c, keys, refs)
+		return err
+	})
+}
+
+// putUndo replaces the undo state with the one of a new bulk operation.
+// Deleting the bookmarks of the previous operation can't be undone anymore,
+// so their articles are deleted now.
+func putUndo(c appengine.Context, state UndoState) os.Error {
+	if len(state.Data) > maxUndoSize {
+		return ErrTooManyBookmarks
+	}
+
+	var old UndoState
+	err := datastore.Get(c, undoKey(c), &old)
+	if err != nil && err != datastore.ErrNoSuchEntity {
+		return err
+	}
+	if err == nil && old.Op == BulkDelete {
+		var bms []Bookmark
+		if err := json.Unmarshal(old.Data, &bms); err != nil {
+			return err
+		}
+		_, err := batches(len(bms), func(start, end int) os.Error {
+			keys := make([]*datastore.Key, 0, end-start)
+			for _, b := range bms[start:end] {
+				keys = append(keys, ArticleKey(c, b.Id))
+			}
+			return datastore.DeleteMulti(c, keys)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = datastore.Put(c, undoKey(c), &state)
+	return err
+}
+
+// Undo reverts the last bulk operation and returns the number of bookmarks
+// it restored. Deleted bookmarks come back as they were, with their
+// articles; other operations only have their tag changes reverted, so later
+// edits are kept. Bookmarks deleted since are skipped.
+func Undo(c appengine.Context) (int, os.Error) {
+	var state UndoState
+	err := datastore.Get(c, undoKey(c), &state)
+	if err == datastore.ErrNoSuchEntity {
+		return 0, ErrNothingToUndo
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	if state.Op == BulkDelete {
+		n, err = undoDelete(c, state.Data)
+	} else {
+		n, err = undoTags(c, state.Data)
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, datastore.Delete(c, undoKey(c))
+}
+
+func undoDelete(c appengine.Context, data []byte) (int, os.Error) {
+	var bms []Bookmark
+	if err := json.Unmarshal(data, &bms); err != nil {
+		return 0, err
+	}
+
+	return batches(len(bms), func(start, end int) os.Error {
+		keys := make([]*datastore.Key, 0, end-start)
+		refs := make([]interface{}, 0, end-start)
+		for i := start; i < end; i++ {
+			keys = append(keys, BookmarkKey(c, bms[i].Id))
+			refs = append(refs, &bms[i])
+		}
+		_, err := datastore.PutMulti(c, keys, refs)
+		return err
+	})
+}
+
+func undoTags(c appengine.Context, data []byte) (int, os.Error) {
+	var changes []tagChange
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return 0, err
+	}
+	now, _, err := os.Time()
+	if err != nil {
+		return 0, err
+	}
+
+	// Bookmarks are loaded one by one to skip those deleted since
+	var keys []*datastore.Key
+	var bms []Bookmark
+	for _, change := range changes {
+		var b Bookmark
+		key := BookmarkKey(c, change.Id)
+		err := datastore.Get(c, key, &b)
+		if err == datastore.ErrNoSuchEntity {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		b.Tags = addTags(removeTags(b.Tags, ParseTags(change.Added)), ParseTags(change.Removed))
+		b.TimeUpdated = now
+		keys, bms = append(keys, key), append(bms, b)
+	}
+
+	return batches(len(bms), func(start, end int) os.Error {
+		refs := make([]interface{}, 0, end-start)
+		for i := start; i < end; i++ {
+			refs = append(refs, &bms[i])
+		}
+		_, err := datastore.PutMulti(c, keys[start:end], refs)
+		return err
+	})
+}
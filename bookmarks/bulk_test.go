@@ -0,0 +1,103 @@
+/*
+	bulk_test.go - tests for the bulk operations of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"strings"
+	"testing"
+)
+
+var bulkBookmarks = []Bookmark{
+	{Id: 1, Tags: []string{"go", "work"}},
+	{Id: 2, Tags: []string{"go", "trash"}},
+	{Id: 3, Tags: []string{"music"}},
+}
+
+func TestAffected(t *testing.T) {
+	tests := []struct {
+		op   BulkOp
+		want []int64
+	}{
+		{BulkOp{Op: BulkAddTags, Tags: []string{"go"}}, []int64{3}},
+		{BulkOp{Op: BulkAddTags, Tags: []string{"!go"}}, []int64{3}},
+		{BulkOp{Op: BulkRemoveTags, Tags: []string{"work", "music"}}, []int64{1, 3}},
+		{BulkOp{Op: BulkReplaceTag, From: "go", To: "golang"}, []int64{1, 2}},
+		{BulkOp{Op: BulkReplaceTag, From: "music", To: "music"}, nil},
+		{BulkOp{Op: BulkTrash}, []int64{1, 3}},
+		{BulkOp{Op: BulkDelete}, []int64{1, 2, 3}},
+	}
+	for _, test := range tests {
+		if got := ids(test.op.Affected(bulkBookmarks)); !sameIds(got, test.want) {
+			t.Errorf("%v.Affected = %v, want %v", test.op, got, test.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	op := BulkOp{Op: BulkAddTags, Tags: []string{"!link", "go"}}
+	orig := op.Tags
+	unique := op.normalize()
+	if strings.Join(op.Tags, ",") != "link,go" || strings.Join(unique, ",") != "link" {
+		t.Errorf("normalize: got tags %v and unique %v", op.Tags, unique)
+	}
+	if orig[0] != "!link" {
+		t.Errorf("normalize modified the caller's tags: %v", orig)
+	}
+
+	op = BulkOp{Op: BulkReplaceTag, From: "old", To: "!new"}
+	unique = op.normalize()
+	if op.To != "new" || strings.Join(unique, ",") != "new" {
+		t.Errorf("normalize: got To %q and unique %v", op.To, unique)
+	}
+}
+
+func TestDiffTags(t *testing.T) {
+	added, removed := diffTags([]string{"a", "b"}, []string{"b", "c", "d"})
+	if strings.Join(added, ",") != "c,d" || strings.Join(removed, ",") != "a" {
+		t.Errorf("diffTags: got added %v, removed %v", added, removed)
+	}
+}
+
+func TestApplyKeepsTags(t *testing.T) {
+	tags := []string{"go", "work"}
+	op := BulkOp{Op: BulkRemoveTags, Tags: []string{"go"}}
+	if got := strings.Join(op.apply(tags), ","); got != "work" {
+		t.Errorf("apply = %q, want %q", got, "work")
+	}
+	if strings.Join(tags, ",") != "go,work" {
+		t.Errorf("apply modified its argument: %v", tags)
+	}
+}
+
+func TestUntagChanges(t *testing.T) {
+	unique := []string{"link", "top"}
+	tagged := [][]int64{{1, 4, 5}, {5, 6}}
+	changes := untagChanges(unique, tagged, bulkBookmarks)
+
+	want := []tagChange{{Id: 4, Removed: "link"}, {Id: 5, Removed: "link,top"}, {Id: 6, Removed: "top"}}
+	if len(changes) != len(want) {
+		t.Fatalf("untagChanges = %v, want %v", changes, want)
+	}
+	for i, change := range changes {
+		if change.Id != want[i].Id || change.Added != "" || change.Removed != want[i].Removed {
+			t.Errorf("untagChanges[%d] = %v, want %v", i, change, want[i])
+		}
+	}
+}
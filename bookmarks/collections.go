@@ -0,0 +1,178 @@
+/*
+	collections.go - saved searches for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCollection = os.NewError("Saved searches need a name of letters, digits, '-', '_' and '.' and a query not using other saved searches")
+
+// Operators of Follow queries that don't select bookmarks
+var queryOperators = []string{"-follow", "-all", "-exact"}
+
+// Collection is a saved search: a full Follow query (tags, operators and
+// search terms) stored under a name, together with a sort order.
+type Collection struct {
+	UserId string
+	Name string
+	Query string
+	Sort string // "" for the default sort order
+	TimeCreated int64
+
+	// Number of matching bookmarks, see CountMatches
+	Count int `datastore:"-"`
+}
+
+func NewCollection(u *user.User, name, query, sortOrder string) Collection {
+	return Collection{UserId: u.Id, Name: strings.ToLower(name), Query: strings.TrimSpace(query), Sort: sortOrder}
+}
+
+func collectionKey(c appengine.Context, userId, name string) *datastore.Key {
+	return datastore.NewKey(c, "Collection", userId+"/"+name, 0, nil)
+}
+
+// Split returns the tag list and the search terms of the saved query.
+func (col Collection) Split() (tagString, query string) {
+	parts := strings.SplitN(col.Query, " ", 2)
+	if len(parts) > 1 {
+		query = parts[1]
+	}
+	return parts[0], query
+}
+
+// Tags returns the tags selecting the bookmarks of the saved search.
+func (col Collection) Tags() []string {
+	tagString, _ := col.Split()
+	return QueryTags(tagString)
+}
+
+// QueryTags returns the tags of a Follow query's tag list, without the
+// operators that don't select bookmarks.
+func QueryTags(tagString string) []string {
+	var tags []string
+	for _, tag := range strings.Split(strings.TrimRight(tagString, "?"), ",") {
+		if has, _ := ContainsTag(queryOperators, tag); !has && tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// matchesTags reports whether the bookmark has all tags and none of the
+// negated ones (and the reading state), just like ByTags would find it.
+func matchesTags(b Bookmark, tags []string) bool {
+	for _, tag := range tags {
+		has := false
+		switch {
+		case tag == "":
+			continue
+		case strings.HasPrefix(tag, StatePrefix):
+			has = b.ReadState == tag[len(StatePrefix):]
+		case tag[0] == '-':
+			has, _ = ContainsTag(b.Tags, tag[1:])
+			has = !has
+		case tag[0] == '!':
+			has, _ = ContainsTag(b.Tags, tag[1:])
+		default:
+			has, _ = ContainsTag(b.Tags, tag)
+		}
+		if !has {
+			return false
+		}
+	}
+	return true
+}
+
+// Match returns the bookmarks that ByTags would find for the tags, in their
+// original order. It saves a query if all bookmarks are loaded anyway.
+func Match(bms []Bookmark, tags []string) []Bookmark {
+	var matches []Bookmark
+	for _, b := range bms {
+		if matchesTags(b, tags) {
+			matches = append(matches, b)
+		}
+	}
+	return matches
+}
+
+// CountMatches returns the number of bookmarks that ByTags would find for
+// the tags.
+func CountMatches(bms []Bookmark, tags []string) int {
+	count := 0
+	for _, b := range bms {
+		if matchesTags(b, tags) {
+			count++
+		}
+	}
+	return count
+}
+
+// validate checks the name, query and sort order. Only the tag list may not
+// use other saved searches; search terms may contain "@".
+func (col Collection) validate() os.Error {
+	tagString, _ := col.Split()
+	if !ValidShortName(col.Name) || col.Query == "" || strings.Contains(tagString, "@") {
+		return ErrInvalidCollection
+	}
+	switch col.Sort {
+	case "", SortTitle, SortFrecency, SortUpdated:
+	default:
+		return ErrInvalidSort
+	}
+	return nil
+}
+
+// Save stores the saved search, replacing one with the same name.
+func (col *Collection) Save(c appengine.Context) os.Error {
+	if err := col.validate(); err != nil {
+		return err
+	}
+	col.TimeCreated = time.Seconds()
+
+	_, err := datastore.Put(c, collectionKey(c, col.UserId, col.Name), col)
+	return err
+}
+
+// CollectionByName returns the current user's saved search with this name.
+func CollectionByName(c appengine.Context, name string) (col Collection, err os.Error) {
+	err = datastore.Get(c, collectionKey(c, user.Current(c).Id, strings.ToLower(name)), &col)
+	if err == datastore.ErrNoSuchEntity {
+		return col, ErrNotFound
+	}
+	return col, err
+}
+
+// Collections returns all saved searches of the current user, ordered by
+// name.
+func Collections(c appengine.Context) (cols []Collection, err os.Error) {
+	q := datastore.NewQuery("Collection").Filter("UserId=", user.Current(c).Id).Order("Name")
+	_, err = q.GetAll(c, &cols)
+	return cols, err
+}
+
+func DeleteCollection(c appengine.Context, name string) os.Error {
+	return datastore.Delete(c, collectionKey(c, user.Current(c).Id, strings.ToLower(name)))
+}
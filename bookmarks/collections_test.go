@@ -0,0 +1,103 @@
+/*
+	collections_test.go - tests for saved searches of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCollectionSplit(t *testing.T) {
+	col := Collection{Query: "go,-exact,-follow? search terms"}
+	tagString, query := col.Split()
+	if tagString != "go,-exact,-follow?" || query != "search terms" {
+		t.Errorf("Split = %q, %q", tagString, query)
+	}
+	if got := strings.Join(col.Tags(), ","); got != "go" {
+		t.Errorf("Tags = %q, want %q", got, "go")
+	}
+}
+
+func TestQueryTags(t *testing.T) {
+	tests := []struct {
+		tagString string
+		want      string
+	}{
+		{"go,work", "go,work"},
+		{"go,-all,,-hidden", "go,-hidden"},
+		{"music?", "music"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := strings.Join(QueryTags(test.tagString), ","); got != test.want {
+			t.Errorf("QueryTags(%q) = %q, want %q", test.tagString, got, test.want)
+		}
+	}
+}
+
+func TestCollectionValidate(t *testing.T) {
+	tests := []struct {
+		col  Collection
+		want os.Error
+	}{
+		{Collection{Name: "work", Query: "work jira"}, nil},
+		{Collection{Name: "mail", Query: "contacts me@example.org"}, nil},
+		{Collection{Name: "nested", Query: "go,@work"}, ErrInvalidCollection},
+		{Collection{Name: "bad name", Query: "go"}, ErrInvalidCollection},
+		{Collection{Name: "empty"}, ErrInvalidCollection},
+		{Collection{Name: "sorted", Query: "go", Sort: "random"}, ErrInvalidSort},
+	}
+	for _, test := range tests {
+		err := test.col.validate()
+		if err != test.want {
+			t.Errorf("validate(%q, %q) = %v, want %v", test.col.Name, test.col.Query, err, test.want)
+		}
+	}
+}
+
+var matchBookmarks = []Bookmark{
+	{Id: 1, Tags: []string{"go", "work"}},
+	{Id: 2, Tags: []string{"go", "hidden"}, ReadState: StateUnread},
+	{Id: 3, Tags: []string{"music"}, ReadState: StateRead},
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		tags []string
+		want []int64
+	}{
+		{[]string{}, []int64{1, 2, 3}},
+		{[]string{"go"}, []int64{1, 2}},
+		{[]string{"!go", "-hidden"}, []int64{1}},
+		{[]string{"go", ""}, []int64{1, 2}},
+		{[]string{StatePrefix + StateUnread}, []int64{2}},
+		{[]string{"-go", StatePrefix + StateUnread}, nil},
+		{[]string{"jazz"}, nil},
+	}
+	for _, test := range tests {
+		if got := ids(Match(matchBookmarks, test.tags)); !sameIds(got, test.want) {
+			t.Errorf("Match(%v) = %v, want %v", test.tags, got, test.want)
+		}
+		if got := CountMatches(matchBookmarks, test.tags); got != len(test.want) {
+			t.Errorf("CountMatches(%v) = %d, want %d", test.tags, got, len(test.want))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+/*
+	dashboard.go - start page sections for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+	The dashboard shows several listings on one page, one section per line:
+
+		Title | query [| sort [| limit]]
+
+	The query is a Follow query or saved search like "work,-hidden" or
+	"@reading". Sort is one of the sort orders (empty for the default) and
+	limit the maximum number of bookmarks shown.
+*/
+
+// Number of bookmarks shown per section unless configured otherwise, and
+// the maximum
+const (
+	DefaultSectionLimit = 10
+	MaxSectionLimit     = 50
+)
+
+type DashboardSection struct {
+	Title string
+	Query string
+	Sort  string
+	Limit int
+}
+
+// ParseDashboard parses the dashboard sections, reporting the first invalid
+// line.
+func ParseDashboard(text string) ([]DashboardSection, os.Error) {
+	var sections []DashboardSection
+	for i, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "|")
+		for j := range fields {
+			fields[j] = strings.TrimSpace(fields[j])
+		}
+		if len(fields) < 2 || len(fields) > 4 || fields[0] == "" || fields[1] == "" {
+			return nil, dashboardError(i, "use 'Title | query [| sort [| limit]]'")
+		}
+
+		s := DashboardSection{Title: fields[0], Query: fields[1], Limit: DefaultSectionLimit}
+		if len(fields) > 2 {
+			s.Sort = fields[2]
+			switch s.Sort {
+			case "", SortTitle, SortFrecency, SortUpdated:
+			default:
+				return nil, dashboardError(i, "unknown sort order '"+s.Sort+"'")
+			}
+		}
+		if len(fields) > 3 {
+			limit, err := strconv.Atoi(fields[3])
+			if err != nil || limit < 1 || limit > MaxSectionLimit {
+				return nil, dashboardError(i, fmt.Sprintf("limit must be a number from 1 to %d", MaxSectionLimit))
+			}
+			s.Limit = limit
+		}
+		sections = append(sections, s)
+	}
+	return sections, nil
+}
+
+func dashboardError(line int, message string) os.Error {
+	return os.NewError(fmt.Sprintf("Dashboard, line %d: %s", line+1, message))
+}
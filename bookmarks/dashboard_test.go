@@ -0,0 +1,71 @@
+/*
+	dashboard_test.go - tests for the dashboard sections of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDashboard(t *testing.T) {
+	text := "Work | work,-hidden | frecency | 5\n\n  Reading|@reading\nNews | news | | 20\n"
+	sections, err := ParseDashboard(text)
+	if err != nil {
+		t.Fatalf("ParseDashboard: %v", err)
+	}
+	want := []DashboardSection{
+		{"Work", "work,-hidden", SortFrecency, 5},
+		{"Reading", "@reading", "", DefaultSectionLimit},
+		{"News", "news", "", 20},
+	}
+	if len(sections) != len(want) {
+		t.Fatalf("ParseDashboard = %v, want %v", sections, want)
+	}
+	for i, s := range sections {
+		w := want[i]
+		if s.Title != w.Title || s.Query != w.Query || s.Sort != w.Sort || s.Limit != w.Limit {
+			t.Errorf("section %d = %v, want %v", i+1, s, w)
+		}
+	}
+}
+
+func TestParseDashboardErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		line string
+	}{
+		{"Work", "line 1"},
+		{"Work | ", "line 1"},
+		{" | work", "line 1"},
+		{"A | a\nB | b | random", "line 2"},
+		{"A | a | title | 0", "line 1"},
+		{"A | a | title | 51", "line 1"},
+		{"A | a | title | ten", "line 1"},
+		{"A | a | title | 5 | extra", "line 1"},
+	}
+	for _, test := range tests {
+		_, err := ParseDashboard(test.text)
+		if err == nil {
+			t.Errorf("ParseDashboard(%q) succeeded, want an error", test.text)
+		} else if !strings.Contains(err.String(), test.line) {
+			t.Errorf("ParseDashboard(%q) = %q, want an error on %s", test.text, err, test.line)
+		}
+	}
+}
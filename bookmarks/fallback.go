@@ -0,0 +1,97 @@
+/*
+	fallback.go - Follow-mode fallback chains for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+/*
+	When Follow mode finds no bookmarks, it tries the steps of the user's
+	fallback chain in order, one per line:
+
+		prefix             bookmarks with a tag starting with the first tag
+		tag [name]         bookmarks tagged name (or the fallback tag from
+		                   the settings), with the whole query as search terms
+		engine <url>       the URL template, with the whole query as search
+		                   terms
+
+	Each step may end in "redirect" (the default) to navigate directly to a
+	single match, or "list" to always show the listing.
+*/
+
+// Fallback step kinds
+const (
+	FallbackPrefix = "prefix"
+	FallbackTag    = "tag"
+	FallbackEngine = "engine"
+)
+
+type FallbackStep struct {
+	Kind     string
+	Arg      string
+	Redirect bool
+}
+
+// ParseFallbacks parses a fallback chain, reporting the first invalid line.
+func ParseFallbacks(text string) ([]FallbackStep, os.Error) {
+	var steps []FallbackStep
+	for i, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		step := FallbackStep{Kind: fields[0], Redirect: true}
+		args := fields[1:]
+		if n := len(args); n > 0 && (args[n-1] == "redirect" || args[n-1] == "list") {
+			step.Redirect = args[n-1] == "redirect"
+			args = args[:n-1]
+		}
+
+		switch step.Kind {
+		case FallbackPrefix:
+			if len(args) != 0 {
+				return nil, fallbackError(i, "prefix takes no argument")
+			}
+		case FallbackTag:
+			if len(args) > 1 {
+				return nil, fallbackError(i, "tag takes at most one tag name")
+			}
+		case FallbackEngine:
+			if len(args) != 1 || !ValidURL(args[0]) {
+				return nil, fallbackError(i, "engine needs a valid URL")
+			}
+		default:
+			return nil, fallbackError(i, "unknown step '"+step.Kind+"'")
+		}
+		if len(args) > 0 {
+			step.Arg = args[0]
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func fallbackError(line int, message string) os.Error {
+	return os.NewError(fmt.Sprintf("Fallback chain, line %d: %s", line+1, message))
+}
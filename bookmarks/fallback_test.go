@@ -0,0 +1,60 @@
+/*
+	fallback_test.go - tests for the Follow-mode fallback chain of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"testing"
+)
+
+func TestParseFallbacks(t *testing.T) {
+	steps, err := ParseFallbacks("prefix list\n\n  tag \ntag music redirect\nengine http://example.com/?q=%s list\n")
+	if err != nil {
+		t.Fatalf("ParseFallbacks: %v", err)
+	}
+	want := []FallbackStep{
+		{FallbackPrefix, "", false},
+		{FallbackTag, "", true},
+		{FallbackTag, "music", true},
+		{FallbackEngine, "http://example.com/?q=%s", false},
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("ParseFallbacks = %v, want %v", steps, want)
+	}
+	for i := range want {
+		got := steps[i]
+		if got.Kind != want[i].Kind || got.Arg != want[i].Arg || got.Redirect != want[i].Redirect {
+			t.Errorf("step %d = %v, want %v", i+1, got, want[i])
+		}
+	}
+}
+
+func TestParseFallbacksErrors(t *testing.T) {
+	for _, text := range []string{
+		"prefix tags",
+		"tag a b",
+		"engine",
+		"engine javascript:alert(1)",
+		"tag\nsearch google",
+	} {
+		if _, err := ParseFallbacks(text); err == nil {
+			t.Errorf("ParseFallbacks(%q) succeeded, want an error", text)
+		}
+	}
+}
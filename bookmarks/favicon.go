@@ -0,0 +1,212 @@
+/*
+	favicon.go - favicon cache for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"appengine/delay"
+	"bytes"
+	"http"
+	"os"
+	"strings"
+	"time"
+)
+
+// How long found and missing favicons are cached, and how long to wait
+// for a queued fetch before queueing another one, in seconds
+const (
+	faviconTTL        = 7 * 24 * 60 * 60
+	missingFaviconTTL = 24 * 60 * 60
+	faviconRetry      = 60 * 60
+)
+
+// Maximum size of a favicon
+const maxFaviconSize = 100 << 10
+
+var ErrInvalidDomain = os.NewError("Invalid domain")
+
+// Favicon is the cached icon of a domain, shared by all users. Domains
+// without an icon are cached with empty Data.
+type Favicon struct {
+	Domain      string
+	Data        []byte
+	ContentType string
+	TimeExpires int64
+}
+
+func faviconKey(c appengine.Context, domain string) *datastore.Key {
+	return datastore.NewKey(c, "Favicon", domain, 0, nil)
+}
+
+// ValidDomain reports whether domain is a host name, optionally with a
+// port.
+func ValidDomain(domain string) bool {
+	if domain == "" || len(domain) > 255 {
+		return false
+	}
+	for _, ch := range domain {
+		switch {
+		case 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9':
+		case ch == '-', ch == '.', ch == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Found reports whether the domain has an icon.
+func (f Favicon) Found() bool {
+	return len(f.Data) > 0
+}
+
+// Expired reports whether the icon should be fetched again.
+func (f Favicon) Expired() bool {
+	return f.TimeExpires <= time.Seconds()
+}
+
+/*
+	Favicons are only fetched by tasks: when the metadata of a bookmark is
+	fetched, and when a user's listing shows one of their bookmarks whose
+	icon is missing or expired (see RefreshFavicon). Requests for the icon
+	never fetch anything themselves, so users can't make us connect to
+	arbitrary hosts.
+*/
+
+// CachedFavicon returns the cached icon of the domain, which may have
+// expired, or ErrNotFound.
+func CachedFavicon(c appengine.Context, domain string) (f Favicon, err os.Error) {
+	if !ValidDomain(domain) {
+		return f, ErrInvalidDomain
+	}
+	err = datastore.Get(c, faviconKey(c, domain), &f)
+	if err == datastore.ErrNoSuchEntity {
+		return f, ErrNotFound
+	}
+	return f, err
+}
+
+// fetchFaviconLater fetches the icon of a domain in a task, see
+// fetchFavicon.
+var fetchFaviconLater = delay.Func("fetchFavicon", fetchFavicon)
+
+// fetchFavicon caches the icon of the domain. Failures are cached as
+// missing icons, so the task is never retried.
+func fetchFavicon(c appengine.Context, domain string) os.Error {
+	cacheFavicon(c, domain, "")
+	return nil
+}
+
+// RefreshFavicon queues a fetch of the icon of the domain, unless one was
+// queued recently. The caller makes sure the domain is one of the user's
+// bookmarks.
+func RefreshFavicon(c appengine.Context, domain string) os.Error {
+	f, err := CachedFavicon(c, domain)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	if err == nil && !f.Expired() {
+		return nil
+	}
+
+	// Keep serving what we have until the task replaces it
+	f.Domain, f.TimeExpires = domain, time.Seconds()+faviconRetry
+	if _, err = datastore.Put(c, faviconKey(c, domain), &f); err != nil {
+		return err
+	}
+	fetchFaviconLater.Call(c, domain)
+	return nil
+}
+
+// cacheFavicon fetches and caches the icon of the domain. The icon linked
+// from the bookmarked page is tried first, if known.
+func cacheFavicon(c appengine.Context, domain, iconURL string) {
+	key := faviconKey(c, domain)
+	var old Favicon
+	datastore.Get(c, key, &old)
+
+	f := findFavicon(fetchClient(c), domain, iconURL)
+	if !f.Found() && old.Found() {
+		// Keep the old icon if the site is down for now
+		f.Data, f.ContentType = old.Data, old.ContentType
+	}
+	if _, err := datastore.Put(c, key, &f); err != nil {
+		c.Errorf("cacheFavicon: %s: %v", domain, err)
+	}
+}
+
+// findFavicon tries the given icon, the icon linked from the domain's start
+// page and /favicon.ico, preferring https to http.
+func findFavicon(client *http.Client, domain, iconURL string) Favicon {
+	f := Favicon{Domain: domain, TimeExpires: time.Seconds() + missingFaviconTTL}
+	roots := []string{"https://" + domain + "/", "http://" + domain + "/"}
+
+	var candidates []string
+	if iconURL != "" {
+		candidates = append(candidates, iconURL)
+	} else {
+		for _, root := range roots {
+			page, err := fetchPage(client, root, maxHeadSize)
+			if err != nil && err != ErrCharset {
+				continue
+			}
+			if icon := ParseMetadata(bytes.NewBuffer(page), root).IconURL; icon != "" {
+				candidates = append(candidates, icon)
+			}
+			break
+		}
+	}
+	for _, root := range roots {
+		candidates = append(candidates, root+"favicon.ico")
+	}
+
+	for _, icon := range candidates {
+		data, _, err := fetch(client, icon, maxFaviconSize)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		// The Content-Type of icons is often wrong, so only their
+		// content counts
+		contentType := iconType(data)
+		if contentType == "" {
+			continue
+		}
+
+		f.Data, f.ContentType = data, contentType
+		f.TimeExpires = time.Seconds() + faviconTTL
+		break
+	}
+	return f
+}
+
+// iconType returns the content type of an icon, or "" if data is no icon
+// we can serve. SVG icons are refused, as they could carry scripts and we
+// serve them from our origin.
+func iconType(data []byte) string {
+	if bytes.HasPrefix(data, []byte("\x00\x00\x01\x00")) {
+		return "image/x-icon"
+	}
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") || strings.Contains(contentType, "svg") {
+		return ""
+	}
+	return contentType
+}
@@ -0,0 +1,141 @@
+/*
+	favicon_test.go - tests for the favicon cache of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"http"
+	"http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testPNG  = "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"
+	testICO  = "\x00\x00\x01\x00\x01\x00\x10\x10"
+	testHTML = "<!DOCTYPE html><html><body>Not found</body></html>"
+	testSVG  = `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`
+)
+
+func TestValidDomain(t *testing.T) {
+	for _, domain := range []string{"example.com", "www.example-site.org", "localhost:8080", "127.0.0.1"} {
+		if !ValidDomain(domain) {
+			t.Errorf("ValidDomain(%q) = false, want true", domain)
+		}
+	}
+	for _, domain := range []string{"", "Example.com", "example.com/path", "user@example.com", "a b", strings.Repeat("a", 256)} {
+		if ValidDomain(domain) {
+			t.Errorf("ValidDomain(%q) = true, want false", domain)
+		}
+	}
+}
+
+func TestIconType(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{testICO, "image/x-icon"},
+		{testPNG, "image/png"},
+		{"GIF89a\x01\x00\x01\x00", "image/gif"},
+		{testHTML, ""},
+		{testSVG, ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := iconType([]byte(test.data)); got != test.want {
+			t.Errorf("iconType(%q) = %q, want %q", test.data, got, test.want)
+		}
+	}
+}
+
+func TestFaviconURL(t *testing.T) {
+	tests := []struct {
+		b    Bookmark
+		want string
+	}{
+		{Bookmark{Id: 7, URL: "https://WWW.Example.com/page"}, "/favicon/www.example.com?id=7"},
+		{Bookmark{URL: "http://localhost:8080/"}, "/favicon/localhost:8080"},
+		{Bookmark{Id: 7, URL: "mailto:someone@example.com"}, "/favicon/"},
+	}
+	for _, test := range tests {
+		if got := test.b.FaviconURL(); got != test.want {
+			t.Errorf("FaviconURL of %q = %q, want %q", test.b.URL, got, test.want)
+		}
+	}
+}
+
+// serveFiles starts a server answering the paths with the given contents,
+// and 404 otherwise.
+func serveFiles(files map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		// Servers often get the type of icons wrong
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(content))
+	}))
+}
+
+func domainOf(server *httptest.Server) string {
+	return server.URL[len("http://"):]
+}
+
+func TestFindFaviconLinked(t *testing.T) {
+	server := serveFiles(map[string]string{
+		"/":                `<html><head><link rel="icon" href="/static/icon.png"></head></html>`,
+		"/static/icon.png": testPNG,
+		"/favicon.ico":     testICO,
+	})
+	defer server.Close()
+
+	f := findFavicon(http.DefaultClient, domainOf(server), "")
+	if string(f.Data) != testPNG || f.ContentType != "image/png" {
+		t.Errorf("findFavicon = %q (%s), want the linked PNG", f.Data, f.ContentType)
+	}
+}
+
+func TestFindFaviconSkipsNonImages(t *testing.T) {
+	server := serveFiles(map[string]string{
+		"/page.ico":    testHTML,
+		"/icon.svg":    testSVG,
+		"/favicon.ico": testICO,
+	})
+	defer server.Close()
+
+	for _, icon := range []string{"/page.ico", "/icon.svg"} {
+		f := findFavicon(http.DefaultClient, domainOf(server), server.URL+icon)
+		if string(f.Data) != testICO || f.ContentType != "image/x-icon" {
+			t.Errorf("findFavicon with %s = %q (%s), want /favicon.ico", icon, f.Data, f.ContentType)
+		}
+	}
+}
+
+func TestFindFaviconMissing(t *testing.T) {
+	server := serveFiles(map[string]string{"/favicon.ico": testHTML})
+	defer server.Close()
+
+	f := findFavicon(http.DefaultClient, domainOf(server), "")
+	if f.Found() || f.Expired() {
+		t.Errorf("findFavicon = %+v, want a cached missing icon", f)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+	fetch.go - fetching web pages for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"appengine"
+	"appengine/urlfetch"
+	"bytes"
+	"http"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"utf8"
+)
+
+// Seconds to wait for a page
+const fetchTimeout = 10
+
+var ErrNotHTML = os.NewError("Page is not an HTML document")
+var ErrCharset = os.NewError("Page uses an unsupported character set")
+
+// fetchClient returns the client for outgoing requests of the context.
+func fetchClient(c appengine.Context) *http.Client {
+	return &http.Client{Transport: &urlfetch.Transport{Context: c, DeadlineSeconds: fetchTimeout}}
+}
+
+// fetch downloads at most limit bytes from the URL, which must be http or
+// https.
+func fetch(client *http.Client, rawurl string, limit int64) (body []byte, contentType string, err os.Error) {
+	if s := URLScheme(rawurl); s != "http" && s != "https" {
+		return nil, "", ErrInvalidScheme
+	}
+
+	resp, err := client.Get(rawurl)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", os.NewError("Fetching " + rawurl + ": " + resp.Status)
+	}
+
+	body, err = ioutil.ReadAll(io.LimitReader(resp.Body, limit))
+	return body, resp.Header.Get("Content-Type"), err
+}
+
+// fetchPage downloads an HTML page and returns it as UTF-8. Pages in
+// charsets that can't be converted are returned unchanged, together with
+// ErrCharset: their markup is usable, but their text is not.
+func fetchPage(client *http.Client, rawurl string, limit int64) ([]byte, os.Error) {
+	body, contentType, err := fetch(client, rawurl, limit)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		return nil, ErrNotHTML
+	}
+	page, ok := toUTF8(body, contentType)
+	if !ok {
+		return page, ErrCharset
+	}
+	return page, nil
+}
+
+// Characters of the Windows code page 1252 for the bytes 0x80 to 0x9F,
+// which are control characters in Latin-1. Unassigned bytes are kept as
+// those control characters, like browsers do.
+var cp1252 = [32]int{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+// toUTF8 converts a page to UTF-8, using the charset of its Content-Type
+// header or of a <meta> tag in its first kilobyte. Latin-1 is decoded as
+// the Windows code page 1252, a superset browsers use for it, just like
+// pages without a charset that aren't valid UTF-8. Pages in other charsets
+// are only kept if they are valid UTF-8 anyway; otherwise toUTF8 reports
+// false.
+func toUTF8(body []byte, contentType string) ([]byte, bool) {
+	charset := charsetParam(contentType)
+	if charset == "" {
+		head := body
+		if len(head) > 1024 {
+			head = head[:1024]
+		}
+		charset = charsetParam(string(head))
+	}
+
+	switch charset {
+	case "utf-8", "utf8":
+		return body, true
+	case "iso-8859-1", "latin1", "latin-1", "windows-1252", "cp1252", "us-ascii":
+	case "":
+		if utf8.Valid(body) {
+			return body, true
+		}
+	default:
+		return body, utf8.Valid(body)
+	}
+
+	var buf bytes.Buffer
+	for _, b := range body {
+		if 0x80 <= b && b <= 0x9F {
+			buf.WriteRune(cp1252[b-0x80])
+		} else {
+			buf.WriteRune(int(b))
+		}
+	}
+	return buf.Bytes(), true
+}
+
+// charsetParam finds a "charset=" parameter in s, lowercased.
+func charsetParam(s string) string {
+	i := strings.Index(strings.ToLower(s), "charset=")
+	if i < 0 {
+		return ""
+	}
+	s = strings.TrimLeft(s[i+len("charset="):], `"' `)
+	end := strings.IndexAny(s, `"' ;>/`)
+	if end >= 0 {
+		s = s[:end]
+	}
+	return strings.ToLower(strings.TrimSpace(s))
+}
@@ -0,0 +1,70 @@
+/*
+	fetch_test.go - tests for page downloads of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"testing"
+)
+
+var utf8Tests = []struct {
+	body        string
+	contentType string
+	want        string
+	ok          bool
+}{
+	{"caf\xe9", "text/html; charset=ISO-8859-1", "café", true},
+	{"\x93quoted\x94 \x80 \x85", "text/html; charset=windows-1252", "“quoted” € …", true},
+	{"\x81", "text/html; charset=latin1", "\u0081", true},
+	{`<meta charset="latin1"><p>caf` + "\xe9", "text/html", "<meta charset=\"latin1\"><p>café", true},
+	{"café", "text/html", "café", true},
+	{"caf\xe9", "text/html", "café", true},
+	{"caf\xe9", "text/html; charset=utf-8", "caf\xe9", true},
+	{"\x82\xa0", "text/html; charset=shift_jis", "\x82\xa0", false},
+	{"plain ascii", "text/html; charset=koi8-r", "plain ascii", true},
+}
+
+func TestToUTF8(t *testing.T) {
+	for _, test := range utf8Tests {
+		got, ok := toUTF8([]byte(test.body), test.contentType)
+		if string(got) != test.want || ok != test.ok {
+			t.Errorf("toUTF8(%q, %q) = %q, %v, want %q, %v", test.body, test.contentType, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestCharsetParam(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"text/html; charset=UTF-8", "utf-8"},
+		{"text/html; Charset=\"ISO-8859-1\"; foo=bar", "iso-8859-1"},
+		{`<meta http-equiv="Content-Type" content="text/html; charset=iso-8859-1">`, "iso-8859-1"},
+		{`<meta charset="Windows-1252">`, "windows-1252"},
+		{`<meta charset=utf-8>`, "utf-8"},
+		{"text/html", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := charsetParam(test.s); got != test.want {
+			t.Errorf("charsetParam(%q) = %q, want %q", test.s, got, test.want)
+		}
+	}
+}
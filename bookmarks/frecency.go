@@ -0,0 +1,121 @@
+/*
+	frecency.go - usage-based ranking for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Frecency combines visit frequency and recency: every visit adds one point,
+// and points lose half their worth every FrecencyHalfLife seconds. Only the
+// score at the time of the last visit is stored; it is decayed on reading.
+var FrecencyHalfLife int64 = 14 * 24 * 60 * 60
+
+// A match must score at least FrecencyDominance times as much as the
+// runner-up to count as clearly the best one.
+var FrecencyDominance = 2.0
+
+func decay(score float64, from, to int64) float64 {
+	if to <= from {
+		return score
+	}
+	return score * math.Pow(2, -float64(to-from)/float64(FrecencyHalfLife))
+}
+
+// addVisit updates the stored score for a visit at time now.
+func (b *Bookmark) addVisit(now int64) {
+	b.Score = decay(b.Score, b.TimeVisited, now) + 1
+	b.Visits++
+	b.TimeVisited = now
+}
+
+// Frecency returns the current score of the bookmark.
+func (b Bookmark) Frecency() float64 {
+	return decay(b.Score, b.TimeVisited, time.Seconds())
+}
+
+// TopMatch returns the index of the bookmark that clearly beats all others
+// by frecency, or -1 if there is none.
+func TopMatch(bms []Bookmark) int {
+	best, first, second := -1, 0.0, 0.0
+	for i, b := range bms {
+		score := b.Frecency()
+		if best < 0 || score > first {
+			best, first, second = i, score, first
+		} else if score > second {
+			second = score
+		}
+	}
+	if best < 0 || first < 1 || first < second*FrecencyDominance {
+		return -1
+	}
+	return best
+}
+
+// titleBefore breaks ties between equally ranked bookmarks, so that the
+// unstable sort.Sort gives the same order on every request.
+func titleBefore(a, b Bookmark) bool {
+	if a.Title != b.Title {
+		return a.Title < b.Title
+	}
+	return a.Id < b.Id
+}
+
+type byFrecency []Bookmark
+
+func (s byFrecency) Len() int      { return len(s) }
+func (s byFrecency) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byFrecency) Less(i, j int) bool {
+	if a, b := s[i].Frecency(), s[j].Frecency(); a != b {
+		return a > b
+	}
+	return titleBefore(s[i], s[j])
+}
+
+type byUpdated []Bookmark
+
+func (s byUpdated) Len() int      { return len(s) }
+func (s byUpdated) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byUpdated) Less(i, j int) bool {
+	if s[i].TimeUpdated != s[j].TimeUpdated {
+		return s[i].TimeUpdated > s[j].TimeUpdated
+	}
+	return titleBefore(s[i], s[j])
+}
+
+// Sort orders for SortBy. ByTags already returns bookmarks sorted by title.
+const (
+	SortTitle    = "title"
+	SortFrecency = "frecency"
+	SortUpdated  = "updated"
+)
+
+// SortBy sorts the bookmarks in the given order. Unknown orders leave the
+// slice untouched.
+func SortBy(bms []Bookmark, order string) {
+	switch order {
+	case SortFrecency:
+		sort.Sort(byFrecency(bms))
+	case SortUpdated:
+		sort.Sort(byUpdated(bms))
+	}
+}
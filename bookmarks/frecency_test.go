@@ -0,0 +1,78 @@
+/*
+	frecency_test.go - tests for the usage-based ranking of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"testing"
+	"time"
+)
+
+func ids(bms []Bookmark) []int64 {
+	result := make([]int64, len(bms))
+	for i, b := range bms {
+		result[i] = b.Id
+	}
+	return result
+}
+
+func sameIds(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSortByTies(t *testing.T) {
+	now := time.Seconds()
+	for _, order := range []string{SortFrecency, SortUpdated} {
+		bms := []Bookmark{
+			{Id: 4, Title: "b", TimeUpdated: 10},
+			{Id: 3, Title: "a", TimeUpdated: 10},
+			{Id: 1, Title: "b", TimeUpdated: 10},
+			{Id: 2, Title: "c", TimeUpdated: 20, Score: 1, TimeVisited: now},
+		}
+		SortBy(bms, order)
+		want := []int64{2, 3, 1, 4}
+		if got := ids(bms); !sameIds(got, want) {
+			t.Errorf("SortBy(%q) = %v, want %v", order, got, want)
+		}
+	}
+}
+
+func TestTopMatch(t *testing.T) {
+	now := time.Seconds()
+	bms := []Bookmark{
+		{Id: 1, Score: 1, TimeVisited: now},
+		{Id: 2, Score: 5, TimeVisited: now},
+	}
+	if i := TopMatch(bms); i != 1 {
+		t.Errorf("TopMatch = %d, want 1", i)
+	}
+
+	bms[0].Score = 4
+	if i := TopMatch(bms); i != -1 {
+		t.Errorf("TopMatch without a clear winner = %d, want -1", i)
+	}
+}
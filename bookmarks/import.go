@@ -0,0 +1,138 @@
+/*
+	import.go - bulk adding of pasted URL lists for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"appengine"
+	"appengine/user"
+	"os"
+	"strings"
+)
+
+// Results of importing a line
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportDuplicate = "duplicate"
+	ImportInvalid   = "invalid URL"
+	ImportSkipped   = "skipped"
+	ImportFailed    = "failed"
+)
+
+// Maximum number of lines imported in one request
+const MaxImportLines = 200
+
+// ImportLine is a single line of a pasted URL list, in the form
+// "URL [title] [| tag,tag]".
+type ImportLine struct {
+	Line   int
+	URL    string
+	Title  string
+	Tags   []string
+	Status string
+	// Why saving failed, for ImportFailed
+	Error string
+}
+
+// ParseImport splits pasted text into lines to import. Empty lines and
+// lines starting with "#" are ignored. Tags follow the last " | ", so URLs
+// and titles may contain "|" themselves.
+func ParseImport(text string) []ImportLine {
+	var lines []ImportLine
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		l := ImportLine{Line: i + 1}
+		if sep := strings.LastIndex(line, " | "); sep >= 0 {
+			l.Tags = ParseTags(line[sep+3:])
+			line = strings.TrimSpace(line[:sep])
+		}
+		parts := strings.SplitN(line, " ", 2)
+		l.URL = parts[0]
+		if len(parts) > 1 {
+			l.Title = strings.TrimSpace(parts[1])
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// Import saves the lines for the given user, adding the shared tags to
+// each, and sets their Status. Existing bookmarks keep their title unless
+// the line has one, and get the new tags added. Lines that fail to save
+// don't stop the import.
+func Import(c appengine.Context, u *user.User, lines []ImportLine, shared []string) {
+	seen := make(map[string]bool)
+	for i := range lines {
+		l := &lines[i]
+		switch {
+		case i >= MaxImportLines:
+			l.Status = ImportSkipped
+			continue
+		case !ValidURL(l.URL):
+			l.Status = ImportInvalid
+			continue
+		case seen[l.URL]:
+			l.Status = ImportDuplicate
+			continue
+		}
+		seen[l.URL] = true
+
+		if err := importLine(c, u, l, shared); err != nil {
+			l.Status, l.Error = ImportFailed, err.String()
+		}
+	}
+}
+
+// importLine saves a single line and sets its Status.
+func importLine(c appengine.Context, u *user.User, l *ImportLine, shared []string) os.Error {
+	b := NewBookmark(u, l.URL, l.Title, addTags(append([]string{}, l.Tags...), shared))
+	key, err := Exists(c, b)
+	if err != nil {
+		return err
+	}
+
+	status := ImportCreated
+	if key != nil {
+		old, err := ByID(c, key.IntID())
+		if err != nil {
+			return err
+		}
+		if (b.Title == "" || b.Title == old.Title) && len(removeTags(b.Tags, old.Tags)) == 0 {
+			l.Status = ImportDuplicate
+			return nil
+		}
+		if b.Title == "" {
+			b.Title = old.Title
+		}
+		b.Method, b.Body = old.Method, old.Body
+		b.Tags = addTags(old.Tags, b.Tags)
+		status = ImportUpdated
+	}
+
+	if _, err = b.Save(c); err != nil {
+		return err
+	}
+	l.Status = status
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+	import_test.go - tests for the URL list import of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseImport(t *testing.T) {
+	text := "# links from chat\n" +
+		"http://example.org/\n" +
+		"\n" +
+		"  https://example.org/a  Some title  \n" +
+		"https://example.org/b | go, work\n" +
+		"https://example.org/c Title | go\n" +
+		"https://example.org/?q=a|b Pipes | in | title | go,work\n" +
+		"https://example.org/d|e\n"
+
+	tests := []struct {
+		line  int
+		url   string
+		title string
+		tags  string
+	}{
+		{2, "http://example.org/", "", ""},
+		{4, "https://example.org/a", "Some title", ""},
+		{5, "https://example.org/b", "", "go,work"},
+		{6, "https://example.org/c", "Title", "go"},
+		{7, "https://example.org/?q=a|b", "Pipes | in | title", "go,work"},
+		{8, "https://example.org/d|e", "", ""},
+	}
+
+	lines := ParseImport(text)
+	if len(lines) != len(tests) {
+		t.Fatalf("ParseImport returned %d lines, want %d: %v", len(lines), len(tests), lines)
+	}
+	for i, test := range tests {
+		l := lines[i]
+		if l.Line != test.line || l.URL != test.url || l.Title != test.title || strings.Join(l.Tags, ",") != test.tags {
+			t.Errorf("line %d = %d %q %q %v, want %d %q %q %q", i, l.Line, l.URL, l.Title, l.Tags, test.line, test.url, test.title, test.tags)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+/*
+	metadata.go - page titles and metadata for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"appengine/delay"
+	"bytes"
+	"html"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"url"
+)
+
+// Maximum number of bytes read for the metadata, which is in the <head>
+const maxHeadSize = 256 << 10
+
+// Maximum length of stored metadata, as datastore strings are limited to
+// 500 bytes
+const maxMetadataLength = 400
+
+// Metadata describes a page as found in its <head>.
+type Metadata struct {
+	Title        string
+	Description  string
+	CanonicalURL string
+	ImageURL     string
+	IconURL      string
+}
+
+// fetchMetadataLater fetches the metadata of a bookmark in a task, see
+// fetchMetadata.
+var fetchMetadataLater = delay.Func("fetchMetadata", fetchMetadata)
+
+// fetchMetadata fills in the metadata of the bookmark with the given ID.
+// The title is only replaced if the user didn't set one. The task runs
+// without a user, and the bookmark may have changed in the meantime, so it
+// is only updated if it still has the URL that was fetched.
+func fetchMetadata(c appengine.Context, id int64) os.Error {
+	var b Bookmark
+	key := BookmarkKey(c, id)
+	if err := datastore.Get(c, key, &b); err != nil {
+		c.Infof("fetchMetadata: bookmark %d: %v", id, err)
+		return nil
+	}
+
+	source := b.URL
+	page, err := fetchPage(fetchClient(c), source, maxHeadSize)
+	if err != nil && err != ErrCharset {
+		c.Infof("fetchMetadata: %s: %v", source, err)
+		return nil
+	}
+	m := ParseMetadata(bytes.NewBuffer(page), source)
+	if err == ErrCharset {
+		// Keep the URLs, but not text we couldn't decode
+		m.Title, m.Description = "", ""
+	}
+
+	// Listings show the icon of the domain, which we know now
+	if domain := b.Domain(); domain != "" {
+		if f, err := CachedFavicon(c, domain); err == ErrNotFound || err == nil && f.Expired() {
+			cacheFavicon(c, domain, m.IconURL)
+		}
+	}
+	now := time.Seconds()
+
+	return datastore.RunInTransaction(c, func(c appengine.Context) os.Error {
+		var b Bookmark
+		if err := datastore.Get(c, key, &b); err != nil {
+			return err
+		}
+		if b.URL != source {
+			return nil
+		}
+		if b.AutoTitle && m.Title != "" {
+			b.Title = m.Title
+		}
+		b.Description, b.CanonicalURL, b.ImageURL = m.Description, m.CanonicalURL, m.ImageURL
+		b.TimeFetched = now
+		_, err := datastore.Put(c, key, &b)
+		return err
+	}, nil)
+}
+
+// ParseMetadata reads the metadata from the <head> of the page at base.
+// OpenGraph properties are preferred to the <title> and the description.
+// Relative URLs are resolved against base, and URLs that aren't http or
+// https are dropped.
+func ParseMetadata(r io.Reader, base string) (m Metadata) {
+	var title, ogTitle, description, ogDescription, canonical, ogURL, image, icon string
+	inTitle := false
+
+	z := html.NewTokenizer(r)
+PARSE:
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			break PARSE
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := make(map[string]string)
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				attrs[string(key)] = string(val)
+			}
+
+			switch string(name) {
+			case "title":
+				inTitle = true
+			case "meta":
+				property := strings.ToLower(attrs["property"])
+				if property == "" {
+					property = strings.ToLower(attrs["name"])
+				}
+				content := attrs["content"]
+				switch property {
+				case "og:title":
+					ogTitle = content
+				case "og:description":
+					ogDescription = content
+				case "description":
+					description = content
+				case "og:url":
+					ogURL = content
+				case "og:image":
+					image = content
+				}
+			case "link":
+				switch strings.ToLower(attrs["rel"]) {
+				case "canonical":
+					canonical = attrs["href"]
+				case "icon", "shortcut icon":
+					icon = attrs["href"]
+				case "apple-touch-icon":
+					if icon == "" {
+						icon = attrs["href"]
+					}
+				}
+			case "body":
+				break PARSE
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				break PARSE
+			}
+
+		case html.TextToken:
+			if inTitle {
+				title += string(z.Text())
+			}
+		}
+	}
+
+	m.Title = cleanMetadata(firstOf(ogTitle, title))
+	m.Description = cleanMetadata(firstOf(ogDescription, description))
+	m.CanonicalURL = resolveURL(base, firstOf(canonical, ogURL))
+	m.ImageURL = resolveURL(base, image)
+	m.IconURL = resolveURL(base, icon)
+	return m
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// cleanMetadata collapses whitespace and cuts the text to the stored length.
+func cleanMetadata(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= maxMetadataLength {
+		return s
+	}
+	cut := 0
+	for i := range s {
+		if i > maxMetadataLength-len("...") {
+			break
+		}
+		cut = i
+	}
+	return s[:cut] + "..."
+}
+
+// resolveURL makes ref absolute, or returns "" if it isn't a valid http or
+// https URL (or too long to be stored).
+func resolveURL(base, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	abs := b.ResolveReference(r).String()
+	if s := URLScheme(abs); s != "http" && s != "https" || len(abs) > maxMetadataLength {
+		return ""
+	}
+	return abs
+}
@@ -0,0 +1,85 @@
+/*
+	metadata_test.go - tests for page metadata of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"strings"
+	"testing"
+	"utf8"
+)
+
+const metadataPage = `<!DOCTYPE html>
+<html>
+<head>
+	<title> Plain
+		title </title>
+	<meta property="og:title" content="OpenGraph title">
+	<meta name="description" content="  A short
+		description. ">
+	<link rel="canonical" href="/canonical">
+	<link rel="apple-touch-icon" href="/touch.png">
+	<link rel="icon" href="//cdn.example.com/icon.png">
+	<meta property="og:image" content="javascript:alert(1)">
+</head>
+<body>
+	<meta property="og:description" content="Not in the head">
+</body>
+</html>`
+
+func TestParseMetadata(t *testing.T) {
+	m := ParseMetadata(strings.NewReader(metadataPage), "http://example.com/blog/post?id=1")
+	want := Metadata{
+		Title:        "OpenGraph title",
+		Description:  "A short description.",
+		CanonicalURL: "http://example.com/canonical",
+		IconURL:      "http://cdn.example.com/icon.png",
+	}
+	if m.Title != want.Title || m.Description != want.Description || m.CanonicalURL != want.CanonicalURL || m.ImageURL != want.ImageURL || m.IconURL != want.IconURL {
+		t.Errorf("ParseMetadata = %+v, want %+v", m, want)
+	}
+}
+
+func TestParseMetadataFallbacks(t *testing.T) {
+	page := `<head><title>Plain title</title>
+		<meta property="og:url" content="https://example.com/og">
+		<meta property="og:image" content="images/cover.jpg">
+		<link rel="apple-touch-icon" href="/touch.png">`
+	m := ParseMetadata(strings.NewReader(page), "https://example.com/blog/post")
+	want := Metadata{
+		Title:        "Plain title",
+		CanonicalURL: "https://example.com/og",
+		ImageURL:     "https://example.com/blog/images/cover.jpg",
+		IconURL:      "https://example.com/touch.png",
+	}
+	if m.Title != want.Title || m.Description != want.Description || m.CanonicalURL != want.CanonicalURL || m.ImageURL != want.ImageURL || m.IconURL != want.IconURL {
+		t.Errorf("ParseMetadata = %+v, want %+v", m, want)
+	}
+}
+
+func TestCleanMetadata(t *testing.T) {
+	if got := cleanMetadata("  a \n\t b  "); got != "a b" {
+		t.Errorf("cleanMetadata = %q, want %q", got, "a b")
+	}
+
+	long := cleanMetadata(strings.Repeat("é", maxMetadataLength))
+	if len(long) > maxMetadataLength || !strings.HasSuffix(long, "...") || !utf8.ValidString(long) {
+		t.Errorf("cleanMetadata of a long text = %q (%d bytes)", long, len(long))
+	}
+}
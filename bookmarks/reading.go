@@ -0,0 +1,120 @@
+/*
+	reading.go - reading list for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+	"os"
+	"sort"
+)
+
+// Reading states of bookmarks on the reading list. Other bookmarks have
+// none ("").
+const (
+	StateUnread   = "unread"
+	StateRead     = "read"
+	StateArchived = "archived"
+)
+
+// Tags like "state:unread" make ByTags filter by reading state.
+const StatePrefix = "state:"
+
+var ErrInvalidState = os.NewError("Reading state must be unread, read, archived or empty")
+
+func ValidState(state string) bool {
+	switch state {
+	case "", StateUnread, StateRead, StateArchived:
+		return true
+	}
+	return false
+}
+
+func (b Bookmark) Unread() bool   { return b.ReadState == StateUnread }
+func (b Bookmark) Read() bool     { return b.ReadState == StateRead }
+func (b Bookmark) Archived() bool { return b.ReadState == StateArchived }
+
+// Added returns when the bookmark was added. Bookmarks stored before this
+// was recorded fall back to their last update.
+func (b Bookmark) Added() int64 {
+	if b.TimeAdded == 0 {
+		return b.TimeUpdated
+	}
+	return b.TimeAdded
+}
+
+type byAdded []Bookmark
+
+func (s byAdded) Len() int      { return len(s) }
+func (s byAdded) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byAdded) Less(i, j int) bool {
+	if a, b := s[i].Added(), s[j].Added(); a != b {
+		return a > b
+	}
+	return titleBefore(s[i], s[j])
+}
+
+// ReadingList returns the bookmarks in the given reading state, most
+// recently added first. Hidden bookmarks are left out, see HideTags.
+func ReadingList(c appengine.Context, settings Settings, state string) ([]Bookmark, os.Error) {
+	if state == "" || !ValidState(state) {
+		return nil, ErrInvalidState
+	}
+	bms, err := ByTags(c, settings.HideTags([]string{StatePrefix + state}))
+	if err != nil {
+		return nil, err
+	}
+	SortByAdded(bms)
+	return bms, nil
+}
+
+// SortByAdded sorts the bookmarks by the time they were added, newest
+// first.
+func SortByAdded(bms []Bookmark) {
+	sort.Sort(byAdded(bms))
+}
+
+// SetState changes the reading state of the current user's bookmark with
+// the given ID. The empty state removes it from the reading list.
+func SetState(c appengine.Context, id int64, state string) os.Error {
+	if !ValidState(state) {
+		return ErrInvalidState
+	}
+	userId := user.Current(c).Id
+
+	return datastore.RunInTransaction(c, func(c appengine.Context) os.Error {
+		var b Bookmark
+		key := BookmarkKey(c, id)
+		err := datastore.Get(c, key, &b)
+		if err == datastore.ErrNoSuchEntity || err == nil && b.UserId != userId {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if state == StateUnread && b.ReadState != StateUnread {
+			extractArticleLater.Call(c, id)
+		}
+		b.ReadState = state
+		_, err = datastore.Put(c, key, &b)
+		return err
+	}, nil)
+}
@@ -0,0 +1,52 @@
+/*
+	reading_test.go - tests for the reading list of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"testing"
+)
+
+func TestValidState(t *testing.T) {
+	for _, state := range []string{"", StateUnread, StateRead, StateArchived} {
+		if !ValidState(state) {
+			t.Errorf("ValidState(%q) = false, want true", state)
+		}
+	}
+	for _, state := range []string{"later", "Unread", StatePrefix + StateUnread} {
+		if ValidState(state) {
+			t.Errorf("ValidState(%q) = true, want false", state)
+		}
+	}
+}
+
+func TestSortByAdded(t *testing.T) {
+	bms := []Bookmark{
+		{Id: 1, Title: "b", TimeAdded: 10},
+		{Id: 2, Title: "a", TimeUpdated: 30},
+		{Id: 3, Title: "c", TimeAdded: 20, TimeUpdated: 40},
+		{Id: 4, Title: "a", TimeAdded: 10},
+		{Id: 5, Title: "b", TimeAdded: 10},
+	}
+	SortByAdded(bms)
+	want := []int64{2, 3, 4, 1, 5}
+	if got := ids(bms); !sameIds(got, want) {
+		t.Errorf("SortByAdded = %v, want %v", got, want)
+	}
+}
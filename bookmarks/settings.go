@@ -0,0 +1,118 @@
+/*
+	settings.go - per-user settings for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+	"os"
+	"strings"
+)
+
+// Settings holds the preferences of a user. Users without stored settings
+// get DefaultSettings.
+type Settings struct {
+	UserId string `json:"-"`
+
+	// Comma-separated tags hidden from listings unless asked for
+	HiddenTags string `json:"hiddenTags"`
+	// Tag used by "tag" fallback steps without a name
+	FallbackTag string `json:"fallbackTag"`
+	// Follow-mode fallback chain, one step per line, see ParseFallbacks
+	Fallbacks string `json:"fallbacks"`
+	// Whether Follow mode navigates directly to a single match
+	FollowRedirect bool `json:"followRedirect"`
+	// Whether followed links forbid sending a referrer
+	NoReferrer bool `json:"noReferrer"`
+	// Sort order of listings, see SortBy
+	DefaultSort string `json:"defaultSort"`
+	// Query listed on the start page
+	StartQuery string `json:"startQuery"`
+	// Sections of the dashboard, see ParseDashboard. If set, the dashboard
+	// is the start page.
+	Dashboard string `json:"dashboard"`
+	// Incremented to revoke all installed bookmarklets
+	TokenGeneration int64 `json:"-"`
+}
+
+var ErrInvalidSort = os.NewError("Unknown sort order")
+
+func DefaultSettings(u *user.User) Settings {
+	return Settings{
+		UserId: u.Id,
+		HiddenTags: "hidden",
+		FallbackTag: "default",
+		Fallbacks: "tag redirect",
+		FollowRedirect: true,
+		DefaultSort: SortTitle,
+	}
+}
+
+func (s Settings) SortTitle() bool    { return s.DefaultSort == SortTitle }
+func (s Settings) SortFrecency() bool { return s.DefaultSort == SortFrecency }
+func (s Settings) SortUpdated() bool  { return s.DefaultSort == SortUpdated }
+
+// HideTags adds the negated hidden tags and the trash to a tag query, unless
+// they are asked for.
+func (s Settings) HideTags(tags []string) []string {
+	for _, tag := range append(ParseTags(s.HiddenTags), TrashTag) {
+		if has, _ := ContainsTag(tags, tag); !has {
+			tags = append(tags, "-"+tag)
+		}
+	}
+	return tags
+}
+
+func settingsKey(c appengine.Context, userId string) *datastore.Key {
+	return datastore.NewKey(c, "Settings", userId, 0, nil)
+}
+
+// CurrentSettings returns the settings of the current user.
+func CurrentSettings(c appengine.Context) (Settings, os.Error) {
+	u := user.Current(c)
+	s := DefaultSettings(u)
+	err := datastore.Get(c, settingsKey(c, u.Id), &s)
+	if err == datastore.ErrNoSuchEntity {
+		err = nil
+	}
+	return s, err
+}
+
+// Save validates and stores the settings.
+func (s *Settings) Save(c appengine.Context) os.Error {
+	if _, err := ParseFallbacks(s.Fallbacks); err != nil {
+		return err
+	}
+	if _, err := ParseDashboard(s.Dashboard); err != nil {
+		return err
+	}
+	switch s.DefaultSort {
+	case SortTitle, SortFrecency, SortUpdated:
+	default:
+		return ErrInvalidSort
+	}
+	s.HiddenTags = strings.Join(ParseTags(s.HiddenTags), ",")
+	if s.FallbackTag = strings.TrimSpace(s.FallbackTag); s.FallbackTag == "" {
+		s.FallbackTag = "default"
+	}
+	_, err := datastore.Put(c, settingsKey(c, s.UserId), s)
+	return err
+}
@@ -0,0 +1,225 @@
+/*
+	shortlinks.go - short link namespace for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrShortNameTaken = os.NewError("Short name is already taken")
+var ErrInvalidShortName = os.NewError("Short names may only contain letters, digits, '-', '_' and '.'")
+
+// Statistics kept per short link: clicks of the last maxStatsDays days and
+// the maxStatsReferrers hosts that linked most, the rest is summed up as
+// "other".
+const (
+	maxStatsDays      = 90
+	maxStatsReferrers = 20
+	otherReferrers    = "(other)"
+)
+
+// ShortLink is a name unique per user that redirects to URL. Unlike unique
+// tags, a name can't be taken over by another link while it is valid.
+type ShortLink struct {
+	UserId string
+	Name string
+	URL string
+	TimeCreated int64
+	TimeExpires int64 // 0 for never
+
+	// Click statistics, see ClickShortLink
+	Clicks int64
+	Days []string
+	DayClicks []int64
+	Referrers []string
+	ReferrerClicks []int64
+}
+
+// Stat is a single row of the statistics for views.
+type Stat struct {
+	Label string
+	Count int64
+}
+
+func NewShortLink(u *user.User, name, url string, expires int64) ShortLink {
+	return ShortLink{UserId: u.Id, Name: strings.ToLower(name), URL: url, TimeExpires: expires}
+}
+
+func shortLinkKey(c appengine.Context, userId, name string) *datastore.Key {
+	return datastore.NewKey(c, "ShortLink", userId+"/"+name, 0, nil)
+}
+
+func ValidShortName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, ch := range name {
+		switch {
+		case 'a' <= ch && ch <= 'z', 'A' <= ch && ch <= 'Z', '0' <= ch && ch <= '9':
+		case ch == '-', ch == '_', ch == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (l ShortLink) Expired() bool {
+	return l.TimeExpires != 0 && l.TimeExpires < time.Seconds()
+}
+
+func (l ShortLink) ExpiresString() string {
+	if l.TimeExpires == 0 {
+		return "never"
+	}
+	return time.SecondsToUTC(l.TimeExpires).Format("2006-01-02")
+}
+
+// Create stores a new short link. It fails with ErrShortNameTaken if the
+// name is already in use by a link that hasn't expired.
+func (l *ShortLink) Create(c appengine.Context) os.Error {
+	if !ValidShortName(l.Name) {
+		return ErrInvalidShortName
+	}
+	if !ValidURL(l.URL) {
+		return ErrInvalidScheme
+	}
+	l.TimeCreated = time.Seconds()
+
+	key := shortLinkKey(c, l.UserId, l.Name)
+	return datastore.RunInTransaction(c, func(c appengine.Context) os.Error {
+		var old ShortLink
+		err := datastore.Get(c, key, &old)
+		if err == nil && !old.Expired() {
+			return ErrShortNameTaken
+		}
+		if err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		_, err = datastore.Put(c, key, l)
+		return err
+	}, nil)
+}
+
+// ShortLinkByName returns the current user's short link with this name.
+func ShortLinkByName(c appengine.Context, name string) (l ShortLink, err os.Error) {
+	err = datastore.Get(c, shortLinkKey(c, user.Current(c).Id, strings.ToLower(name)), &l)
+	if err == datastore.ErrNoSuchEntity {
+		return l, ErrNotFound
+	}
+	return l, err
+}
+
+// ShortLinks returns all short links of the current user, ordered by name.
+func ShortLinks(c appengine.Context) (links []ShortLink, err os.Error) {
+	q := datastore.NewQuery("ShortLink").Filter("UserId=", user.Current(c).Id).Order("Name")
+	_, err = q.GetAll(c, &links)
+	return links, err
+}
+
+func DeleteShortLink(c appengine.Context, name string) os.Error {
+	return datastore.Delete(c, shortLinkKey(c, user.Current(c).Id, strings.ToLower(name)))
+}
+
+// ClickShortLink records a visit of the short link, coming from the given
+// referrer host ("" for direct visits).
+func ClickShortLink(c appengine.Context, name, referrer string) os.Error {
+	if referrer == "" {
+		referrer = "(direct)"
+	}
+	day := time.UTC().Format("2006-01-02")
+
+	key := shortLinkKey(c, user.Current(c).Id, strings.ToLower(name))
+	return datastore.RunInTransaction(c, func(c appengine.Context) os.Error {
+		var l ShortLink
+		if err := datastore.Get(c, key, &l); err != nil {
+			return err
+		}
+		l.Clicks++
+		l.countDay(day)
+		l.countReferrer(referrer)
+		_, err := datastore.Put(c, key, &l)
+		return err
+	}, nil)
+}
+
+func (l *ShortLink) countDay(day string) {
+	if n := len(l.Days); n > 0 && l.Days[n-1] == day {
+		l.DayClicks[n-1]++
+		return
+	}
+	l.Days = append(l.Days, day)
+	l.DayClicks = append(l.DayClicks, 1)
+	if n := len(l.Days); n > maxStatsDays {
+		l.Days = l.Days[n-maxStatsDays:]
+		l.DayClicks = l.DayClicks[n-maxStatsDays:]
+	}
+}
+
+func (l *ShortLink) countReferrer(referrer string) {
+	for i, r := range l.Referrers {
+		if r == referrer {
+			l.ReferrerClicks[i]++
+			return
+		}
+	}
+	if len(l.Referrers) >= maxStatsReferrers {
+		referrer = otherReferrers
+		for i, r := range l.Referrers {
+			if r == referrer {
+				l.ReferrerClicks[i]++
+				return
+			}
+		}
+	}
+	l.Referrers = append(l.Referrers, referrer)
+	l.ReferrerClicks = append(l.ReferrerClicks, 1)
+}
+
+// DayStats returns the clicks per day, most recent first.
+func (l ShortLink) DayStats() []Stat {
+	stats := make([]Stat, len(l.Days))
+	for i, day := range l.Days {
+		stats[len(l.Days)-1-i] = Stat{day, l.DayClicks[i]}
+	}
+	return stats
+}
+
+type byCount []Stat
+
+func (s byCount) Len() int           { return len(s) }
+func (s byCount) Less(i, j int) bool { return s[i].Count > s[j].Count }
+func (s byCount) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// ReferrerStats returns the clicks per referrer host, most frequent first.
+func (l ShortLink) ReferrerStats() []Stat {
+	stats := make([]Stat, len(l.Referrers))
+	for i, r := range l.Referrers {
+		stats[i] = Stat{r, l.ReferrerClicks[i]}
+	}
+	sort.Sort(byCount(stats))
+	return stats
+}
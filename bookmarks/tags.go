@@ -0,0 +1,176 @@
+/*
+	tags.go - tag statistics for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"sort"
+	"strings"
+)
+
+// TagCount is a tag together with the number of bookmarks using it.
+type TagCount struct {
+	Name string
+	Count int
+}
+
+type byUsage []TagCount
+
+func (s byUsage) Len() int      { return len(s) }
+func (s byUsage) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byUsage) Less(i, j int) bool {
+	if s[i].Count != s[j].Count {
+		return s[i].Count > s[j].Count
+	}
+	return s[i].Name < s[j].Name
+}
+
+// CountTags returns all tags used by the bookmarks, most used first.
+func CountTags(bms []Bookmark) []TagCount {
+	counts := make(map[string]int)
+	for _, b := range bms {
+		for _, tag := range b.Tags {
+			if tag != "" {
+				counts[tag]++
+			}
+		}
+	}
+
+	tags := make([]TagCount, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, TagCount{name, count})
+	}
+	sort.Sort(byUsage(tags))
+	return tags
+}
+
+// CompleteTag returns the tags starting with prefix, most used first.
+func CompleteTag(tags []TagCount, prefix string) []TagCount {
+	var matches []TagCount
+	for _, tag := range tags {
+		if strings.HasPrefix(tag.Name, prefix) {
+			matches = append(matches, tag)
+		}
+	}
+	return matches
+}
+
+// TagCompletion is a suggestion for a comma-separated tag list.
+type TagCompletion struct {
+	Name  string `json:"name"`  // completed tag
+	Count int    `json:"count"` // bookmarks using the tag
+	Value string `json:"value"` // the whole tag list with the last tag completed
+}
+
+// CompleteTagList completes the last tag of a comma-separated tag list like
+// "coding,!li". Operator prefixes ("!" and "-") are kept, tags already in
+// the list are not suggested again.
+func CompleteTagList(tags []TagCount, input string) []TagCompletion {
+	i := strings.LastIndex(input, ",")
+	head, prefix := input[:i+1], strings.TrimLeft(input[i+1:], " ")
+	if prefix != "" && (prefix[0] == '-' || prefix[0] == '!') {
+		head, prefix = head+prefix[:1], prefix[1:]
+	}
+
+	used := make(map[string]bool)
+	for _, tag := range strings.Split(input[:i+1], ",") {
+		used[strings.TrimLeft(strings.TrimSpace(tag), "-!")] = true
+	}
+
+	var completions []TagCompletion
+	for _, tag := range CompleteTag(tags, prefix) {
+		if used[tag.Name] {
+			continue
+		}
+		completions = append(completions, TagCompletion{tag.Name, tag.Count, head + tag.Name})
+	}
+	return completions
+}
+
+// ResolvePrefix returns the tag that is the only one starting with prefix.
+// An exact match always resolves to itself.
+func ResolvePrefix(tags []TagCount, prefix string) (string, bool) {
+	matches := CompleteTag(tags, prefix)
+	for _, tag := range matches {
+		if tag.Name == prefix {
+			return prefix, true
+		}
+	}
+	if len(matches) != 1 {
+		return "", false
+	}
+	return matches[0].Name, true
+}
+
+// SimilarTags returns up to max tags that are a few typos away from tag,
+// closest and then most used first.
+func SimilarTags(tags []TagCount, tag string, max int) []string {
+	limit := 1
+	if len(tag) > 4 {
+		limit = 2
+	}
+
+	var similar [3][]string
+	for _, t := range tags {
+		if d := editDistance(tag, t.Name); d > 0 && d <= limit {
+			similar[d] = append(similar[d], t.Name)
+		}
+	}
+
+	var names []string
+	for _, bucket := range similar {
+		names = append(names, bucket...)
+	}
+	if len(names) > max {
+		names = names[:max]
+	}
+	return names
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	s, t := []int(a), []int(b)
+	row := make([]int, len(t)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			next := min(row[j]+1, row[j-1]+1, prev+cost)
+			prev, row[j] = row[j], next
+		}
+	}
+	return row[len(t)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,120 @@
+/*
+	tags_test.go - tests for tag completion of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"strings"
+	"testing"
+)
+
+var testCounts = []TagCount{{"github", 3}, {"golang", 2}, {"go", 1}, {"music", 1}}
+
+func TestCountTags(t *testing.T) {
+	counts := CountTags([]Bookmark{
+		{Tags: []string{"b", "a"}},
+		{Tags: []string{"b", ""}},
+		{Tags: []string{"c"}},
+	})
+	var got []string
+	for _, tag := range counts {
+		got = append(got, tag.Name)
+	}
+	if strings.Join(got, ",") != "b,a,c" || counts[0].Count != 2 {
+		t.Errorf("CountTags = %v, want b (2), a, c", counts)
+	}
+}
+
+func TestCompleteTagList(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"gi", "github"},
+		{"music,!g", "music,!github music,!golang music,!go"},
+		{"go,g", "go,github go,golang"},
+		{"music, -gol", "music,-golang"},
+		{"x", ""},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, completion := range CompleteTagList(testCounts, test.input) {
+			got = append(got, completion.Value)
+		}
+		if strings.Join(got, " ") != test.want {
+			t.Errorf("CompleteTagList(%q) = %v, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestResolvePrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+		ok     bool
+	}{
+		{"gi", "github", true},
+		{"go", "go", true},
+		{"gol", "golang", true},
+		{"g", "", false},
+		{"x", "", false},
+	}
+	for _, test := range tests {
+		got, ok := ResolvePrefix(testCounts, test.prefix)
+		if got != test.want || ok != test.ok {
+			t.Errorf("ResolvePrefix(%q) = %q, %v, want %q, %v", test.prefix, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestSimilarTags(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"musik", "music"},
+		{"golnag", "golang"},
+		{"gp", "go"},
+		{"go", ""},
+		{"jazz", ""},
+	}
+	for _, test := range tests {
+		if got := strings.Join(SimilarTags(testCounts, test.tag, 3), ","); got != test.want {
+			t.Errorf("SimilarTags(%q) = %q, want %q", test.tag, got, test.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"abc", "abc", 0},
+		{"über", "uber", 1},
+	}
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+/*
+	template.go - URL templates for search bookmarks in Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+	"url"
+)
+
+/*
+	A bookmark URL may contain placeholders that are filled with the search
+	query in Follow mode:
+
+		%s, %*         the whole query
+		%1 ... %9      the n-th word of the query
+		%{name}        the value of a "name=value" word of the query
+		%{1|default}   any of the above, with a default if it is missing
+		%{date:layout} the current date, formatted with a Go time layout
+		%%             a literal percent sign
+
+	%1 to %9 followed by a hex digit are left alone, as they are most likely
+	escapes like %20 - use %{1} instead. Values are escaped to fit where
+	they appear: as a path segment before the "?", as a query value after it.
+
+	The form body of POST bookmarks uses the same placeholders, in the form
+	"name=value&other=%s".
+*/
+
+// urlArgs is a search query split up for template expansion.
+type urlArgs struct {
+	all        string
+	positional []string
+	named      map[string]string
+}
+
+func parseArgs(query string) urlArgs {
+	args := urlArgs{all: strings.TrimSpace(query), named: make(map[string]string)}
+	for _, word := range strings.Fields(query) {
+		if i := strings.Index(word, "="); i > 0 {
+			args.named[word[:i]] = word[i+1:]
+		} else {
+			args.positional = append(args.positional, word)
+		}
+	}
+	return args
+}
+
+func (args urlArgs) get(name string) (value string, ok bool) {
+	if name == "*" || name == "s" {
+		return args.all, args.all != ""
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		if n < 1 || n > len(args.positional) {
+			return "", false
+		}
+		return args.positional[n-1], true
+	}
+	value, ok = args.named[name]
+	return
+}
+
+// expand evaluates the expression inside %{...}.
+func (args urlArgs) expand(expr string, now int64) string {
+	if strings.HasPrefix(expr, "date:") {
+		return time.SecondsToUTC(now).Format(expr[len("date:"):])
+	}
+	def := ""
+	if i := strings.Index(expr, "|"); i >= 0 {
+		expr, def = expr[:i], expr[i+1:]
+	}
+	if value, ok := args.get(expr); ok {
+		return value
+	}
+	return def
+}
+
+func isHex(ch byte) bool {
+	return '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func escapeArg(s string, inQuery bool) string {
+	s = url.QueryEscape(s)
+	if !inQuery {
+		s = strings.Replace(s, "+", "%20", -1)
+	}
+	return s
+}
+
+// FormatURL fills the search query into the placeholders of a URL template,
+// using now for date placeholders.
+func FormatURL(tmpl, query string, now int64) string {
+	return format(tmpl, query, now, false)
+}
+
+// format expands a template, starting in the path or query part.
+func format(tmpl, query string, now int64, inQuery bool) string {
+	args := parseArgs(query)
+	var buf bytes.Buffer
+	for i := 0; i < len(tmpl); i++ {
+		ch := tmpl[i]
+		if ch != '%' || i+1 == len(tmpl) {
+			switch ch {
+			case '?':
+				inQuery = true
+			case '#':
+				inQuery = false
+			}
+			buf.WriteByte(ch)
+			continue
+		}
+
+		next := tmpl[i+1]
+		switch {
+		case next == '%':
+			buf.WriteByte('%')
+			i++
+		case next == 's', next == '*':
+			buf.WriteString(escapeArg(args.all, inQuery))
+			i++
+		case '1' <= next && next <= '9' && (i+2 == len(tmpl) || !isHex(tmpl[i+2])):
+			value, _ := args.get(string(next))
+			buf.WriteString(escapeArg(value, inQuery))
+			i++
+		case next == '{' && strings.Index(tmpl[i+2:], "}") >= 0:
+			end := i + 2 + strings.Index(tmpl[i+2:], "}")
+			buf.WriteString(escapeArg(args.expand(tmpl[i+2:end], now), inQuery))
+			i = end
+		default:
+			buf.WriteByte(ch)
+		}
+	}
+	return buf.String()
+}
+
+// TargetURL returns the URL to navigate to, with the bookmark's search query
+// filled in.
+func (b Bookmark) TargetURL() string {
+	return FormatURL(b.URL, b.Query, time.Seconds())
+}
+
+// FormField is a single field of the form sent by POST bookmarks.
+type FormField struct {
+	Name  string
+	Value string
+}
+
+// FormFields returns the body of a POST bookmark with the search query
+// filled in. The body is expanded in its escaped form first, so the query
+// can't inject additional fields.
+func (b Bookmark) FormFields() []FormField {
+	var fields []FormField
+	body := format(b.Body, b.Query, time.Seconds(), true)
+	for _, pair := range strings.Split(body, "&") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		field := FormField{Name: unescapeField(kv[0])}
+		if len(kv) > 1 {
+			field.Value = unescapeField(kv[1])
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// unescapeField decodes a form field, keeping it as-is if it contains
+// stray percent signs.
+func unescapeField(s string) string {
+	if u, err := url.QueryUnescape(s); err == nil {
+		return u
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+/*
+	template_test.go - tests for the URL templates of Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"testing"
+)
+
+var formatTests = []struct {
+	tmpl  string
+	query string
+	want  string
+}{
+	{"http://example.com/?q=%s", "go lang", "http://example.com/?q=go+lang"},
+	{"http://example.com/wiki/%s", "go lang", "http://example.com/wiki/go%20lang"},
+	{"http://example.com/%1/%2?q=%*", "a b", "http://example.com/a/b?q=a+b"},
+	{"http://example.com/%3", "a b", "http://example.com/"},
+	{"http://example.com/?lang=%{lang|en}", "word lang=de", "http://example.com/?lang=de"},
+	{"http://example.com/?lang=%{lang|en}", "word", "http://example.com/?lang=en"},
+	{"http://example.com/?x=%{missing}", "word", "http://example.com/?x="},
+	{"http://example.com/a%20b?q=%1", "x", "http://example.com/a%20b?q=x"},
+	{"http://example.com/100%%?q=%s", "x", "http://example.com/100%?q=x"},
+	{"http://example.com/?q=%s", "a&b=c", "http://example.com/?q=a%26b%3Dc"},
+	{"http://example.com/%{date:2006-01-02}", "", "http://example.com/1970-01-01"},
+	{"http://example.com/plain", "ignored", "http://example.com/plain"},
+}
+
+func TestFormatURL(t *testing.T) {
+	for _, test := range formatTests {
+		if got := FormatURL(test.tmpl, test.query, 0); got != test.want {
+			t.Errorf("FormatURL(%q, %q) = %q, want %q", test.tmpl, test.query, got, test.want)
+		}
+	}
+}
+
+func TestFormFields(t *testing.T) {
+	b := Bookmark{Method: MethodPost, Body: "q=%s&lang=en", Query: "a&b=c"}
+	fields := b.FormFields()
+	if len(fields) != 2 {
+		t.Fatalf("FormFields = %v, want 2 fields", fields)
+	}
+	if fields[0].Name != "q" || fields[0].Value != "a&b=c" {
+		t.Errorf("first field = %v, want q=a&b=c", fields[0])
+	}
+	if fields[1].Name != "lang" || fields[1].Value != "en" {
+		t.Errorf("second field = %v, want lang=en", fields[1])
+	}
+}
@@ -0,0 +1,59 @@
+/*
+	visits.go - click-through statistics for Bin o'Bookmarks
+
+	Copyright (C) 2012  Constantin "xConStruct" Schomburg <me@xconstruct.net>
+
+	Bin o'Bookmarks is free software: you can redistribute it and/or modify
+	it under the terms of the GNU General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	Bin o'Bookmarks is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU General Public License for more details.
+
+	You should have received a copy of the GNU General Public License
+	along with Foobar.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package bookmarks
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"os"
+	"strconv"
+	"url"
+)
+
+// GoURL returns the click-through link for the bookmark, which records the
+// visit before redirecting to the target.
+func (b Bookmark) GoURL() string {
+	if b.Id == 0 || !ValidURL(b.URL) {
+		return b.SafeURL()
+	}
+	if b.Query != "" {
+		return "/go/" + strconv.Itoa64(b.Id) + "?q=" + url.QueryEscape(b.Query)
+	}
+	return "/go/" + strconv.Itoa64(b.Id)
+}
+
+// Visit records a click-through on the bookmark with the given ID.
+func Visit(c appengine.Context, id int64) os.Error {
+	now, _, err := os.Time()
+	if err != nil {
+		return err
+	}
+
+	return datastore.RunInTransaction(c, func(c appengine.Context) os.Error {
+		var b Bookmark
+		key := BookmarkKey(c, id)
+		if err := datastore.Get(c, key, &b); err != nil {
+			return err
+		}
+		b.addVisit(now)
+		_, err := datastore.Put(c, key, &b)
+		return err
+	}, nil)
+}
@@ -25,10 +25,27 @@ $(function() {
 		});
 	});
 
-	$('#bookmarks .bookmark .edit').click(function() {
-		var bookmark = $(this).parents(".bookmark");
-		$('#create .url').val($(bookmark).data('url'));
-		$('#create .title').val($(bookmark).data('title'));
-		$('#create .tags').val($(bookmark).data('tags'));
+	// Complete the last tag of the list while typing
+	$('input.tags').attr('autocomplete', 'off').keyup(function() {
+		$.getJSON('/tags/complete', {q: $(this).val()}, function(completions) {
+			var list = $('#tag_completions').empty();
+			$.each(completions || [], function(i, completion) {
+				list.append($('<option>')
+					.attr('value', completion.value)
+					.text(completion.name + ' (' + completion.count + ')'));
+			});
+		});
+	});
+
+	// Launcher of "-all" queries
+	$('#open_all').click(function() {
+		$('#launcher a.launch').each(function() {
+			window.open(this.href, '_blank');
+		});
+	});
+
+	$('a.bookmarklet').click(function(e) {
+		e.preventDefault();
+		alert("Drag this link to your bookmarks bar and use it on the page you want to save.");
 	});
 });